@@ -1,106 +1,402 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // profile time zones must resolve without system tzdata
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/jimsyyap/error_app/backend/config"
 	"github.com/jimsyyap/error_app/backend/internal/handlers"
 	"github.com/jimsyyap/error_app/backend/internal/middleware"
+	"github.com/jimsyyap/error_app/backend/internal/throttle"
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/database"
+	"github.com/jimsyyap/error_app/backend/pkg/mailer"
 	"github.com/jimsyyap/error_app/backend/pkg/models"
+	"github.com/jimsyyap/error_app/backend/pkg/oidc"
 )
 
 // main is the entry point of the Tennis Error Tracker backend.
 // It initializes the configuration, database, router, and starts the server.
 func main() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Printf("Warning: Could not load .env file: %v. Proceeding with system environment variables.", err)
-	}
-
-	// Load configuration from environment variables
-	cfg, err := config.LoadConfig()
+	// Load configuration from environment variables (and .env if present)
+	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Establish database connection
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		cfg.DBHost, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBPort)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := database.New(&cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	defer db.Close()
 	log.Println("Successfully connected to the database")
 
-	// Auto-migrate database schema
-	err = db.AutoMigrate(&models.User{}, &models.MatchSession{}, &models.ErrorType{}, &models.ErrorLog{})
+	// Migrate the schema and seed error types
+	if err := db.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	// Promote the configured user if there is no admin yet
+	if err := db.BootstrapAdmin(cfg.Auth.BootstrapAdmin); err != nil {
+		log.Fatalf("Failed to bootstrap admin: %v", err)
+	}
+
+	// Purge accounts whose deletion grace period has ended
+	go purgeDeletedUsers(db, time.Hour)
+
+	// Load the JWT signing keys
+	keys, err := loadKeyring(cfg.JWT)
 	if err != nil {
-		log.Fatalf("Failed to auto-migrate database schema: %v", err)
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
 	}
 
-	// Seed Error_Types table if empty
-	seedErrorTypes(db)
+	// Initialize handlers
+	mail := newMailer(cfg.Mail)
+	passwords := newPasswordHasher(cfg.Auth)
+	verificationHandler := &handlers.VerificationHandler{
+		DB:         db.DB,
+		Mailer:     mail,
+		BaseURL:    cfg.Mail.BaseURL,
+		Expiry:     cfg.Auth.VerifyExpiry,
+		ResendWait: cfg.Auth.VerifyResendWait,
+	}
+	authHandler := &handlers.AuthHandler{
+		DB:              db.DB,
+		Keys:            keys,
+		AccessExpiry:    cfg.JWT.AccessExpiry,
+		RefreshExpiry:   cfg.JWT.RefreshExpiry,
+		Passwords:       passwords,
+		Verifier:        verificationHandler,
+		RequireVerified: cfg.Auth.EmailVerification == "login",
+		AccountThrottle: newLoginThrottle(db, cfg.Auth, "account", cfg.Auth.LockoutThreshold),
+		IPThrottle:      newLoginThrottle(db, cfg.Auth, "ip", cfg.Auth.LockoutIPThreshold),
+	}
+	passwordHandler := &handlers.PasswordHandler{
+		DB:          db.DB,
+		Mailer:      mail,
+		BaseURL:     cfg.Mail.BaseURL,
+		ResetExpiry: cfg.Auth.ResetExpiry,
+		ResendWait:  cfg.Auth.ResetResendWait,
+		Passwords:   passwords,
+	}
+	magicLinkHandler := &handlers.MagicLinkHandler{
+		DB:            db.DB,
+		Auth:          authHandler,
+		Mailer:        mail,
+		BaseURL:       cfg.Mail.BaseURL,
+		Expiry:        cfg.Auth.MagicLinkExpiry,
+		EmailThrottle: newLoginThrottle(db, cfg.Auth, "magic_link", cfg.Auth.MagicLinkLimit),
+		IPThrottle:    newLoginThrottle(db, cfg.Auth, "magic_link_ip", cfg.Auth.MagicLinkIPLimit),
+	}
+	webAuthnHandler := &handlers.WebAuthnHandler{
+		DB:       db.DB,
+		WebAuthn: newWebAuthn(cfg),
+		Auth:     authHandler,
+	}
+	mfaHandler := &handlers.MFAHandler{DB: db.DB, Issuer: cfg.Auth.TOTPIssuer}
+	oidcHandler := &handlers.OIDCHandler{
+		DB:        db.DB,
+		Auth:      authHandler,
+		Providers: discoverProviders(cfg.OIDC),
+	}
+	apiTokenHandler := &handlers.APITokenHandler{DB: db.DB}
+	adminHandler := &handlers.AdminHandler{
+		DB:     db.DB,
+		Auth:   authHandler,
+		Resets: passwordHandler,
+	}
+	coachingHandler := &handlers.CoachingHandler{DB: db.DB}
+	orgHandler := &handlers.OrgHandler{DB: db.DB}
+	profileHandler := &handlers.ProfileHandler{DB: db.DB}
+	accountHandler := &handlers.AccountHandler{
+		DB:            db.DB,
+		DeletionGrace: cfg.Auth.DeletionGrace,
+		Auth:          authHandler,
+	}
+	auditHandler := &handlers.AuditHandler{DB: db.DB}
+	deviceHandler := &handlers.DeviceHandler{DB: db.DB}
+	sessionHandler := &handlers.SessionHandler{DB: db.DB}
+	errorHandler := &handlers.ErrorHandler{DB: db.DB}
+	outcomeHandler := &handlers.OutcomeHandler{DB: db.DB}
 
 	// Initialize Gin router
 	router := gin.Default()
-
-	// Apply global middleware
-	router.Use(middleware.CORS()) // Enable CORS for frontend integration
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Define public routes
-	router.POST("/register", handlers.Register(db))
-	router.POST("/login", handlers.Login(db))
+	router.POST("/register", authHandler.Register)
+	router.POST("/login", authHandler.Login)
+	router.POST("/login/mfa", authHandler.VerifyMFA)
+	router.POST("/login/magic", magicLinkHandler.RequestLink)
+	router.GET("/login/magic/:token", magicLinkHandler.ExchangeLink)
+	router.POST("/login/passkey/begin", webAuthnHandler.BeginLogin)
+	router.POST("/login/passkey/finish", webAuthnHandler.FinishLogin)
+	router.GET("/oidc/:provider/login", oidcHandler.Login)
+	router.GET("/oidc/:provider/callback", oidcHandler.Callback)
+	router.POST("/token/refresh", authHandler.Refresh)
+	router.POST("/logout", authHandler.Logout)
+	router.POST("/account/restore", authHandler.RestoreAccount)
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	router.POST("/password/forgot", passwordHandler.ForgotPassword)
+	router.POST("/password/reset", passwordHandler.ResetPassword)
+	router.GET("/verify-email", verificationHandler.VerifyEmail)
+	router.POST("/verify-email", verificationHandler.VerifyEmail)
+	router.POST("/verify-email/resend", verificationHandler.ResendVerification)
 
 	// Define protected routes group with JWT authentication middleware
 	protected := router.Group("/")
-	protected.Use(middleware.Authenticate(db, cfg.JWTSecret))
+	protected.Use(middleware.JWTMiddleware(keys, db.DB))
+	if cfg.Auth.EmailVerification == "routes" {
+		protected.Use(middleware.RequireVerifiedEmail())
+	}
+	{
+		protected.POST("/sessions", middleware.RequireScope(auth.ScopeSessionsWrite), sessionHandler.StartSession)
+		protected.PUT("/sessions/:session_id", middleware.RequireScope(auth.ScopeSessionsWrite), sessionHandler.EndSession)
+		protected.GET("/sessions", middleware.RequireScope(auth.ScopeSessionsRead), sessionHandler.GetSessions)
+		protected.GET("/sessions/active", middleware.RequireScope(auth.ScopeSessionsRead), sessionHandler.GetActiveSession)
+		protected.GET("/sessions/:session_id", middleware.RequireScope(auth.ScopeSessionsRead), sessionHandler.GetSession)
+		protected.PUT("/sessions/:session_id/scoring", middleware.RequireScope(auth.ScopeSessionsWrite), sessionHandler.StartScoring)
+		protected.POST("/sessions/:session_id/points", middleware.RequireScope(auth.ScopeSessionsWrite), sessionHandler.RecordPoint)
+		protected.DELETE("/sessions/:session_id/points/last", middleware.RequireScope(auth.ScopeSessionsWrite), sessionHandler.UndoLastPoint)
+		protected.GET("/sessions/:session_id/summary", middleware.RequireScope(auth.ScopeSessionsRead), sessionHandler.GetSummary)
+		protected.GET("/sessions/:session_id/summary/pivot", middleware.RequireScope(auth.ScopeSessionsRead), sessionHandler.GetErrorPivot)
+		protected.GET("/sessions/:session_id/annotations", middleware.RequireScope(auth.ScopeSessionsRead), coachingHandler.ListOwnAnnotations)
+		protected.GET("/sessions/:session_id/outcomes", middleware.RequireScope(auth.ScopeErrorsRead), outcomeHandler.ListOutcomes)
+		protected.GET("/sessions/:session_id/outcomes/summary", middleware.RequireScope(auth.ScopeErrorsRead), outcomeHandler.GetOutcomeSummary)
+		protected.POST("/errors", middleware.RequireScope(auth.ScopeErrorsWrite), errorHandler.LogError)
+		protected.DELETE("/errors/last", middleware.RequireScope(auth.ScopeErrorsWrite), errorHandler.UndoLastError)
+		protected.GET("/error-types", middleware.RequireScope(auth.ScopeErrorsRead), errorHandler.GetErrorTypes)
+		protected.POST("/error-types", middleware.RequireScope(auth.ScopeErrorsWrite), errorHandler.CreateErrorType)
+		protected.PUT("/error-types/:error_type_id", middleware.RequireScope(auth.ScopeErrorsWrite), errorHandler.UpdateErrorType)
+		protected.DELETE("/error-types/:error_type_id", middleware.RequireScope(auth.ScopeErrorsWrite), errorHandler.ArchiveErrorType)
+		protected.POST("/error-types/:error_type_id/restore", middleware.RequireScope(auth.ScopeErrorsWrite), errorHandler.RestoreErrorType)
+		protected.POST("/outcomes", middleware.RequireScope(auth.ScopeErrorsWrite), outcomeHandler.RecordOutcome)
+		protected.DELETE("/outcomes/last", middleware.RequireScope(auth.ScopeErrorsWrite), outcomeHandler.UndoLastOutcome)
+	}
+
+	// Account management is only available to interactive logins by the
+	// account owner
+	account := protected.Group("/me")
+	account.Use(middleware.DenyAPITokens(), middleware.DenyImpersonation())
+	{
+		account.GET("", profileHandler.GetMe)
+		account.PATCH("", profileHandler.UpdateProfile)
+		account.DELETE("", accountHandler.DeleteAccount)
+		account.GET("/export", accountHandler.Export)
+		account.POST("/password", authHandler.ChangePassword)
+		account.GET("/audit", auditHandler.ListMine)
+		account.GET("/devices", deviceHandler.ListDevices)
+		account.DELETE("/devices/:device_id", deviceHandler.RevokeDevice)
+		account.GET("/passkeys", webAuthnHandler.ListPasskeys)
+		account.POST("/passkeys/begin", webAuthnHandler.BeginRegistration)
+		account.POST("/passkeys/finish", webAuthnHandler.FinishRegistration)
+		account.DELETE("/passkeys/:credential_id", webAuthnHandler.DeletePasskey)
+		account.POST("/mfa/totp", mfaHandler.EnrollTOTP)
+		account.POST("/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+		account.DELETE("/mfa/totp", mfaHandler.DisableTOTP)
+		account.GET("/tokens", apiTokenHandler.ListTokens)
+		account.POST("/tokens", apiTokenHandler.CreateToken)
+		account.DELETE("/tokens/:token_id", apiTokenHandler.RevokeToken)
+	}
+
+	// Coach–player links are managed by the users themselves
+	links := protected.Group("/links")
+	links.Use(middleware.DenyAPITokens())
+	{
+		links.GET("", coachingHandler.ListLinks)
+		links.POST("", coachingHandler.Invite)
+		links.POST("/:link_id/accept", coachingHandler.AcceptLink)
+		links.PATCH("/:link_id/permission", coachingHandler.SetLinkPermission)
+		links.DELETE("/:link_id", coachingHandler.RevokeLink)
+	}
+
+	// Coach access to linked players' data
+	players := protected.Group("/players/:player_id")
+	{
+		players.GET("/sessions", middleware.RequireScope(auth.ScopeSessionsRead), coachingHandler.ListPlayerSessions)
+		players.GET("/sessions/:session_id/errors", middleware.RequireScope(auth.ScopeErrorsRead), coachingHandler.ListPlayerErrors)
+		players.GET("/sessions/:session_id/summary", middleware.RequireScope(auth.ScopeSessionsRead), coachingHandler.GetPlayerSummary)
+		players.GET("/sessions/:session_id/summary/pivot", middleware.RequireScope(auth.ScopeSessionsRead), coachingHandler.GetPlayerErrorPivot)
+		players.GET("/sessions/:session_id/outcomes/summary", middleware.RequireScope(auth.ScopeErrorsRead), coachingHandler.GetPlayerOutcomeSummary)
+		players.GET("/sessions/:session_id/annotations", middleware.RequireScope(auth.ScopeSessionsRead), coachingHandler.ListPlayerAnnotations)
+		players.POST("/sessions/:session_id/annotations", middleware.DenyAPITokens(), coachingHandler.AddAnnotation)
+	}
+
+	// Organizations; members only see their own organizations' data
+	orgs := protected.Group("/orgs")
+	orgs.Use(middleware.DenyAPITokens())
 	{
-		protected.POST("/sessions", handlers.StartSession(db))
-		protected.PUT("/sessions/:session_id", handlers.EndSession(db))
-		protected.GET("/sessions", handlers.ListSessions(db))
-		protected.POST("/errors", handlers.LogError(db))
-		protected.DELETE("/errors/last", handlers.UndoLastError(db))
-		protected.GET("/sessions/:session_id/summary", handlers.GetSummary(db))
-		protected.GET("/error-types", handlers.GetErrorTypes(db))
+		orgs.GET("", orgHandler.ListOrgs)
+		orgs.POST("", orgHandler.CreateOrg)
+		orgs.GET("/:org_id", orgHandler.GetOrg)
+		orgs.GET("/:org_id/members", orgHandler.ListMembers)
+		orgs.POST("/:org_id/members", orgHandler.AddMember)
+		orgs.PUT("/:org_id/members/:user_id/role", orgHandler.SetMemberRole)
+		orgs.DELETE("/:org_id/members/:user_id", orgHandler.RemoveMember)
+		orgs.GET("/:org_id/sessions", orgHandler.ListSessions)
+		orgs.GET("/:org_id/error-types", orgHandler.ListErrorTypes)
+		orgs.POST("/:org_id/error-types", orgHandler.CreateErrorType)
+		orgs.PUT("/:org_id/error-types/:error_type_id", orgHandler.UpdateErrorType)
+		orgs.DELETE("/:org_id/error-types/:error_type_id", orgHandler.DeleteErrorType)
+		orgs.POST("/:org_id/error-types/:error_type_id/restore", orgHandler.RestoreErrorType)
 	}
 
-	// Determine server port
-	port := cfg.Port
-	if port == "" {
-		port = "8080" // Default port if not specified
+	// Admin-only routes
+	admin := protected.Group("/admin")
+	admin.Use(middleware.DenyAPITokens(), middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.POST("/error-types", adminHandler.CreateErrorType)
+		admin.PUT("/error-types/:error_type_id", adminHandler.UpdateErrorType)
+		admin.DELETE("/error-types/:error_type_id", adminHandler.DeleteErrorType)
+		admin.POST("/error-types/:error_type_id/restore", adminHandler.RestoreErrorType)
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.GET("/users/:user_id", adminHandler.GetUser)
+		admin.GET("/users/:user_id/sessions", adminHandler.ListUserSessions)
+		admin.PUT("/users/:user_id/role", adminHandler.SetUserRole)
+		admin.POST("/users/:user_id/disable", adminHandler.DisableUser)
+		admin.POST("/users/:user_id/enable", adminHandler.EnableUser)
+		admin.POST("/users/:user_id/password-reset", adminHandler.ForcePasswordReset)
+		admin.POST("/users/:user_id/impersonate", adminHandler.Impersonate)
+		admin.GET("/lockouts", adminHandler.ListLockouts)
+		admin.GET("/audit", auditHandler.ListAll)
 	}
 
 	// Start the server
-	log.Printf("Starting Tennis Error Tracker server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
+	log.Printf("Starting Tennis Error Tracker server on port %s", cfg.Server.Port)
+	if err := router.Run(":" + cfg.Server.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
-// seedErrorTypes populates the Error_Types table with predefined error types if it's empty.
-func seedErrorTypes(db *gorm.DB) {
-	var count int64
-	if err := db.Model(&models.ErrorType{}).Count(&count).Error; err != nil {
-		log.Fatalf("Failed to check Error_Types table: %v", err)
+// loadKeyring loads the signing keys from JWT_KEY_DIR and reloads them on
+// SIGHUP so keys can be rotated without a restart, as described on
+// auth.Keyring. Without a key directory an ephemeral development key is
+// generated.
+func loadKeyring(cfg config.JWTConfig) (*auth.Keyring, error) {
+	if cfg.KeyDir == "" {
+		log.Println("Warning: JWT_KEY_DIR not set, using an ephemeral signing key")
+		return auth.NewEphemeralKeyring()
+	}
+
+	keys, err := auth.LoadKeyring(cfg.KeyDir, cfg.ActiveKeyID)
+	if err != nil {
+		return nil, err
 	}
 
-	if count == 0 {
-		errorTypes := []models.ErrorType{
-			{Name: "Forehand"},
-			{Name: "Backhand"},
-			{Name: "Serve"},
-			{Name: "Volley"},
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := keys.Reload(); err != nil {
+				log.Printf("Failed to reload JWT signing keys: %v", err)
+				continue
+			}
+			log.Println("Reloaded JWT signing keys")
 		}
-		if err := db.Create(&errorTypes).Error; err != nil {
-			log.Fatalf("Failed to seed error types: %v", err)
+	}()
+
+	return keys, nil
+}
+
+// newMailer builds the mailer selected by MAIL_DRIVER
+func newMailer(cfg config.MailConfig) mailer.Mailer {
+	if cfg.Driver == "smtp" {
+		return &mailer.SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	}
+	log.Printf("Writing outgoing email to %s", cfg.OutboxDir)
+	return &mailer.OutboxMailer{Dir: cfg.OutboxDir, From: cfg.From}
+}
+
+// discoverProviders fetches the discovery document of each configured OIDC
+// provider. Providers that cannot be reached are skipped.
+func discoverProviders(configs []oidc.Config) map[string]*oidc.Provider {
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for _, pc := range configs {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err := oidc.NewProvider(ctx, pc, nil)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: OIDC provider %s disabled: %v", pc.Name, err)
+			continue
+		}
+		providers[pc.Name] = provider
+		log.Printf("Enabled OIDC provider %s", pc.Name)
+	}
+	return providers
+}
+
+// newPasswordHasher builds the password hashing policy
+func newPasswordHasher(cfg config.AuthConfig) *auth.PasswordHasher {
+	if cfg.PasswordHash != auth.AlgorithmArgon2id && cfg.PasswordHash != auth.AlgorithmBcrypt {
+		log.Fatalf("Unknown PASSWORD_HASH_ALGORITHM %q", cfg.PasswordHash)
+	}
+	params := auth.DefaultArgon2Params
+	params.Memory = uint32(cfg.Argon2Memory)
+	params.Time = uint32(cfg.Argon2Time)
+	params.Threads = uint8(cfg.Argon2Threads)
+	return &auth.PasswordHasher{
+		Algorithm:  cfg.PasswordHash,
+		BcryptCost: cfg.BcryptCost,
+		Argon2:     params,
+	}
+}
+
+// newWebAuthn builds the passkey relying party. Origins default to the
+// frontend URL.
+func newWebAuthn(cfg *config.Config) *webauthn.WebAuthn {
+	origins := cfg.Auth.WebAuthnOrigins
+	if len(origins) == 0 {
+		origins = []string{cfg.Mail.BaseURL}
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.Auth.WebAuthnRPID,
+		RPDisplayName: cfg.Auth.WebAuthnRPName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		log.Fatalf("Invalid WebAuthn configuration: %v", err)
+	}
+	return w
+}
+
+// newLoginThrottle builds a failed-login throttle for one scope
+func newLoginThrottle(db *database.DB, cfg config.AuthConfig, scope string, threshold int) *throttle.Throttle {
+	return &throttle.Throttle{
+		DB:        db.DB,
+		Scope:     scope,
+		Threshold: threshold,
+		Base:      time.Duration(cfg.LockoutBase) * time.Second,
+		Max:       time.Duration(cfg.LockoutMax) * time.Second,
+		Window:    time.Duration(cfg.LockoutWindow) * time.Second,
+	}
+}
+
+// purgeDeletedUsers periodically removes accounts past their deletion grace
+// period
+func purgeDeletedUsers(db *database.DB, interval time.Duration) {
+	for {
+		purged, err := db.PurgeDeletedUsers(time.Now())
+		if err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
 		}
-		log.Println("Successfully seeded Error_Types table")
+		time.Sleep(interval)
 	}
 }
@@ -3,9 +3,11 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/jimsyyap/error_app/backend/pkg/database"
+	"github.com/jimsyyap/error_app/backend/pkg/oidc"
 )
 
 // Config holds all application configuration
@@ -13,19 +15,71 @@ type Config struct {
 	Server   ServerConfig
 	Database database.Config
 	JWT      JWTConfig
+	Auth     AuthConfig
+	Mail     MailConfig
+	OIDC     []oidc.Config
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  int
-	WriteTimeout int
+	Port           string
+	ReadTimeout    int
+	WriteTimeout   int
+	TrustedProxies []string // IPs or CIDRs whose X-Forwarded-For is believed; none by default
 }
 
 // JWTConfig holds JWT-related configuration
 type JWTConfig struct {
-	Secret string
-	Expiry int // in hours
+	KeyDir        string // directory of PEM signing keys, one file per kid
+	ActiveKeyID   string // kid used for signing; newest private key already loaded if empty
+	AccessExpiry  int    // in minutes
+	RefreshExpiry int    // in hours
+}
+
+// AuthConfig holds settings for account flows such as password reset
+type AuthConfig struct {
+	ResetExpiry       int    // in minutes
+	ResetResendWait   int    // in seconds
+	VerifyExpiry      int    // in hours
+	VerifyResendWait  int    // in seconds
+	EmailVerification string // "off", "login" or "routes"
+	TOTPIssuer        string // issuer name shown in authenticator apps
+
+	LockoutThreshold   int // failed logins per account before lockout
+	LockoutIPThreshold int // failed logins per IP before lockout
+	LockoutBase        int // first lockout in seconds, doubled per failure
+	LockoutMax         int // longest lockout in seconds
+	LockoutWindow      int // seconds after which failures are forgotten
+
+	MagicLinkExpiry  int // in minutes
+	MagicLinkLimit   int // sign-in links per email before throttling
+	MagicLinkIPLimit int // sign-in links per IP before throttling
+
+	WebAuthnRPID    string   // domain passkeys are bound to
+	WebAuthnRPName  string   // name shown when creating a passkey
+	WebAuthnOrigins []string // allowed origins; APP_BASE_URL if empty
+
+	BootstrapAdmin string // username promoted to admin while no admin exists
+
+	DeletionGrace int // days a deleted account can still be restored
+
+	PasswordHash  string // "argon2id" or "bcrypt" for new hashes
+	BcryptCost    int
+	Argon2Memory  int // in KiB
+	Argon2Time    int // iterations
+	Argon2Threads int
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Driver       string // "smtp" or "outbox"
+	From         string
+	BaseURL      string // frontend URL used to build links in emails
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	OutboxDir    string
 }
 
 // Load loads configuration from environment variables
@@ -38,6 +92,9 @@ func Load() (*Config, error) {
 			Port:         getEnv("SERVER_PORT", "8080"),
 			ReadTimeout:  getEnvAsInt("SERVER_READ_TIMEOUT", 10),
 			WriteTimeout: getEnvAsInt("SERVER_WRITE_TIMEOUT", 10),
+			// Client IPs drive the login throttles and the audit log, so
+			// forwarding headers are ignored unless the proxy is listed
+			TrustedProxies: strings.Fields(getEnv("TRUSTED_PROXIES", "")),
 		},
 		Database: database.Config{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -48,14 +105,82 @@ func Load() (*Config, error) {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-secret-key"),
-			Expiry: getEnvAsInt("JWT_EXPIRY", 24),
+			KeyDir:        getEnv("JWT_KEY_DIR", ""),
+			ActiveKeyID:   getEnv("JWT_ACTIVE_KID", ""),
+			AccessExpiry:  getEnvAsInt("JWT_ACCESS_EXPIRY", 15),
+			RefreshExpiry: getEnvAsInt("JWT_REFRESH_EXPIRY", 720),
 		},
+		Auth: AuthConfig{
+			ResetExpiry:       getEnvAsInt("PASSWORD_RESET_EXPIRY", 60),
+			ResetResendWait:   getEnvAsInt("PASSWORD_RESET_RESEND_WAIT", 60),
+			VerifyExpiry:      getEnvAsInt("EMAIL_VERIFY_EXPIRY", 48),
+			VerifyResendWait:  getEnvAsInt("EMAIL_VERIFY_RESEND_WAIT", 60),
+			EmailVerification: getEnv("EMAIL_VERIFICATION", "off"),
+			TOTPIssuer:        getEnv("TOTP_ISSUER", "Tennis Error Tracker"),
+
+			LockoutThreshold:   getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+			LockoutIPThreshold: getEnvAsInt("LOGIN_LOCKOUT_IP_THRESHOLD", 20),
+			LockoutBase:        getEnvAsInt("LOGIN_LOCKOUT_BASE", 30),
+			LockoutMax:         getEnvAsInt("LOGIN_LOCKOUT_MAX", 3600),
+			LockoutWindow:      getEnvAsInt("LOGIN_LOCKOUT_WINDOW", 900),
+
+			MagicLinkExpiry:  getEnvAsInt("MAGIC_LINK_EXPIRY", 15),
+			MagicLinkLimit:   getEnvAsInt("MAGIC_LINK_LIMIT", 3),
+			MagicLinkIPLimit: getEnvAsInt("MAGIC_LINK_IP_LIMIT", 10),
+
+			WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", "localhost"),
+			WebAuthnRPName:  getEnv("WEBAUTHN_RP_NAME", "Tennis Error Tracker"),
+			WebAuthnOrigins: strings.Fields(getEnv("WEBAUTHN_ORIGINS", "")),
+
+			BootstrapAdmin: getEnv("ADMIN_BOOTSTRAP_USERNAME", ""),
+
+			DeletionGrace: getEnvAsInt("ACCOUNT_DELETION_GRACE_DAYS", 30),
+
+			PasswordHash:  getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			BcryptCost:    getEnvAsInt("BCRYPT_COST", 12),
+			Argon2Memory:  getEnvAsInt("ARGON2_MEMORY", 64*1024),
+			Argon2Time:    getEnvAsInt("ARGON2_TIME", 3),
+			Argon2Threads: getEnvAsInt("ARGON2_THREADS", 2),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "outbox"),
+			From:         getEnv("MAIL_FROM", "Tennis Error Tracker <no-reply@localhost>"),
+			BaseURL:      getEnv("APP_BASE_URL", "http://localhost:3000"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUser:     getEnv("SMTP_USER", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			OutboxDir:    getEnv("MAIL_OUTBOX_DIR", "tmp/outbox"),
+		},
+		OIDC: loadOIDCProviders(),
 	}
 
 	return config, nil
 }
 
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS. Each
+// provider NAME is configured with OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID,
+// OIDC_NAME_CLIENT_SECRET, OIDC_NAME_REDIRECT_URL and OIDC_NAME_SCOPES.
+func loadOIDCProviders() []oidc.Config {
+	var providers []oidc.Config
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, oidc.Config{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "")),
+		})
+	}
+	return providers
+}
+
 // Helper function to get an environment variable or return a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
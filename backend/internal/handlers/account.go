@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// AccountHandler handles data export and account deletion
+type AccountHandler struct {
+	DB            *gorm.DB
+	DeletionGrace int          // days a deleted account can still be restored
+	Auth          *AuthHandler // checks the password with the login lockout
+}
+
+// DeleteAccountRequest re-confirms the password before deleting an account
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AccountExport is the JSON document inside the export archive
+type AccountExport struct {
+	ExportedAt time.Time             `json:"exported_at"`
+	User       models.User           `json:"user"`
+	Profile    models.PlayerProfile  `json:"profile"`
+	Sessions   []models.MatchSession `json:"sessions"`
+	Points     []models.Point        `json:"points"`
+	Outcomes   []models.PointOutcome `json:"outcomes"`
+	ErrorLogs  []models.ErrorLog     `json:"error_logs"`
+	ErrorTypes []models.ErrorType    `json:"error_types"`
+}
+
+// Export downloads all of the user's data as a zip archive holding
+// export.json and one CSV file per table
+func (h *AccountHandler) Export(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	export, err := h.collectExport(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	archive, err := export.Archive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+		return
+	}
+
+	filename := fmt.Sprintf("tennis-errors-%s-%s.zip", export.User.Username, export.ExportedAt.Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// DeleteAccount schedules the account for deletion after the grace period.
+// Until then it is disabled and can be restored with its credentials.
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Accounts created through an identity provider have no password yet
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set a password with a password reset before deleting your account"})
+		return
+	}
+	if !h.Auth.verifyCurrentPassword(c, &user, req.Password, "Invalid password") {
+		return
+	}
+
+	deleteAfter := time.Now().AddDate(0, 0, h.DeletionGrace)
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := user.ScheduleDeletion(tx, deleteAfter); err != nil {
+			return err
+		}
+		// Sign out everywhere
+		return models.RevokeUserRefreshTokens(tx, user.UserID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditAccountDeleted, user.UserID, "", map[string]string{"delete_after": deleteAfter.UTC().Format(time.RFC3339)})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Account scheduled for deletion",
+		"delete_after": deleteAfter,
+	})
+}
+
+// collectExport loads everything the user owns
+func (h *AccountHandler) collectExport(userID uuid.UUID) (*AccountExport, error) {
+	export := &AccountExport{ExportedAt: time.Now().UTC()}
+
+	if err := h.DB.First(&export.User, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	profile, err := loadProfile(h.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Profile = *profile
+
+	if err := h.DB.Where("user_id = ?", userID).Order("start_time").Find(&export.Sessions).Error; err != nil {
+		return nil, err
+	}
+
+	sessionIDs := h.DB.Model(&models.MatchSession{}).Select("session_id").Where("user_id = ?", userID)
+	if err := h.DB.Where("session_id IN (?)", sessionIDs).Order("session_id, sequence").Find(&export.Points).Error; err != nil {
+		return nil, err
+	}
+	if err := h.DB.Where("session_id IN (?)", sessionIDs).Order("timestamp").Find(&export.Outcomes).Error; err != nil {
+		return nil, err
+	}
+	if err := h.DB.Preload("ErrorType").Where("session_id IN (?)", sessionIDs).Order("timestamp").Find(&export.ErrorLogs).Error; err != nil {
+		return nil, err
+	}
+
+	// Every error type the logs refer to, including organization types, and
+	// the user's own types
+	typeIDs := h.DB.Model(&models.ErrorLog{}).Select("error_type_id").Where("session_id IN (?)", sessionIDs)
+	if err := h.DB.Where("error_type_id IN (?) OR user_id = ?", typeIDs, userID).Order("error_type_id").Find(&export.ErrorTypes).Error; err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// Archive writes the export as a zip of export.json and CSV files
+func (e *AccountExport) Archive() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	w, err := zw.Create("export.json")
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(e); err != nil {
+		return nil, err
+	}
+
+	p := e.Profile
+	if err := writeCSV(zw, "profile.csv",
+		[]string{"username", "email", "display_name", "dominant_hand", "backhand", "ntrp_rating", "utr_rating", "time_zone", "preferred_surface"},
+		[][]string{{e.User.Username, e.User.Email, optString(p.DisplayName), optString(p.DominantHand), optString(p.Backhand),
+			optFloat(p.NTRPRating), optFloat(p.UTRRating), optString(p.TimeZone), optString(p.PreferredSurface)}},
+	); err != nil {
+		return nil, err
+	}
+
+	sessions := make([][]string, len(e.Sessions))
+	for i, s := range e.Sessions {
+		sessions[i] = []string{s.SessionID.String(), s.StartTime.UTC().Format(time.RFC3339), optTime(s.EndTime),
+			optString(s.OpponentName), optString(s.Location), optString(s.Score), optString(s.Notes)}
+	}
+	if err := writeCSV(zw, "sessions.csv",
+		[]string{"session_id", "start_time", "end_time", "opponent_name", "location", "score", "notes"}, sessions); err != nil {
+		return nil, err
+	}
+
+	points := make([][]string, len(e.Points))
+	for i, pt := range e.Points {
+		points[i] = []string{pt.SessionID.String(), strconv.Itoa(pt.Sequence), string(pt.Winner), pt.Timestamp.UTC().Format(time.RFC3339)}
+	}
+	if err := writeCSV(zw, "points.csv", []string{"session_id", "sequence", "winner", "timestamp"}, points); err != nil {
+		return nil, err
+	}
+
+	logs := make([][]string, len(e.ErrorLogs))
+	for i, l := range e.ErrorLogs {
+		logs[i] = []string{l.ErrorID.String(), l.SessionID.String(), strconv.Itoa(l.ErrorTypeID), l.Timestamp.UTC().Format(time.RFC3339),
+			optInt(l.SetNumber), optInt(l.GameNumber), optInt(l.PointNumber), optString(l.Server), optBool(l.BreakPoint), optBool(l.SetPoint),
+			optString(l.Miss), optString(l.Direction), optString(l.Spin)}
+	}
+	if err := writeCSV(zw, "error_logs.csv",
+		[]string{"error_id", "session_id", "error_type_id", "timestamp", "set_number", "game_number", "point_number", "server", "break_point", "set_point",
+			"miss", "direction", "spin"}, logs); err != nil {
+		return nil, err
+	}
+
+	outcomes := make([][]string, len(e.Outcomes))
+	for i, o := range e.Outcomes {
+		pointID := ""
+		if o.PointID != nil {
+			pointID = o.PointID.String()
+		}
+		outcomes[i] = []string{o.OutcomeID.String(), o.SessionID.String(), string(o.Kind), string(o.Shot), string(o.Player), pointID,
+			o.Timestamp.UTC().Format(time.RFC3339), optInt(o.SetNumber), optInt(o.GameNumber), optInt(o.PointNumber), optString(o.Server),
+			optBool(o.BreakPoint), optBool(o.SetPoint)}
+	}
+	if err := writeCSV(zw, "outcomes.csv",
+		[]string{"outcome_id", "session_id", "kind", "shot", "player", "point_id", "timestamp", "set_number", "game_number", "point_number", "server",
+			"break_point", "set_point"}, outcomes); err != nil {
+		return nil, err
+	}
+
+	types := make([][]string, len(e.ErrorTypes))
+	for i, t := range e.ErrorTypes {
+		orgID := ""
+		if t.OrgID != nil {
+			orgID = t.OrgID.String()
+		}
+		userID := ""
+		if t.UserID != nil {
+			userID = t.UserID.String()
+		}
+		types[i] = []string{strconv.Itoa(t.ErrorTypeID), t.Name, orgID, userID, optInt(t.ParentID), optTime(t.ArchivedAt)}
+	}
+	if err := writeCSV(zw, "error_types.csv", []string{"error_type_id", "name", "org_id", "user_id", "parent_id", "archived_at"}, types); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCSV adds a CSV file with a header row to the archive
+func writeCSV(zw *zip.Writer, name string, header []string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+func optString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func optInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func optBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func optTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// AdminHandler handles admin-only operations
+type AdminHandler struct {
+	DB     *gorm.DB
+	Auth   *AuthHandler     // signs impersonation tokens
+	Resets *PasswordHandler // sends forced password reset links
+}
+
+// ErrorTypeRequest represents an error type creation or update request.
+// Fields other than the name are left unchanged on update when omitted.
+type ErrorTypeRequest struct {
+	Name       string   `json:"name" binding:"required,max=50"`
+	ParentID   *int     `json:"parent_id" binding:"omitempty,min=0"` // 0 moves the type to the top level
+	Position   *int     `json:"position"`
+	Color      *string  `json:"color"`                                                                // #rrggbb, or empty to clear
+	Attributes []string `json:"attributes" binding:"omitempty,unique,dive,oneof=miss direction spin"` // all if omitted on creation
+}
+
+// RoleRequest represents a role change request
+type RoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// CreateErrorType adds a new global error type
+func (h *AdminHandler) CreateErrorType(c *gin.Context) {
+	var req ErrorTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveErrorType(c, h.DB, &models.ErrorType{}, &req)
+}
+
+// UpdateErrorType changes a global error type
+func (h *AdminHandler) UpdateErrorType(c *gin.Context) {
+	var req ErrorTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errorType, ok := h.findErrorType(c)
+	if !ok {
+		return
+	}
+
+	saveErrorType(c, h.DB, errorType, &req)
+}
+
+// DeleteErrorType archives a global error type. Errors logged with it stay
+// valid but no new ones can be.
+func (h *AdminHandler) DeleteErrorType(c *gin.Context) {
+	errorType, ok := h.findErrorType(c)
+	if !ok {
+		return
+	}
+
+	setErrorTypeArchived(c, h.DB, errorType, true)
+}
+
+// RestoreErrorType brings back an archived global error type
+func (h *AdminHandler) RestoreErrorType(c *gin.Context) {
+	errorType, ok := h.findErrorType(c)
+	if !ok {
+		return
+	}
+
+	setErrorTypeArchived(c, h.DB, errorType, false)
+}
+
+// findErrorType loads the global error type in the URL
+func (h *AdminHandler) findErrorType(c *gin.Context) (*models.ErrorType, bool) {
+	id, err := strconv.Atoi(c.Param("error_type_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid error type ID"})
+		return nil, false
+	}
+
+	var errorType models.ErrorType
+	if err := h.DB.Scopes(visibleErrorTypes(nil, nil)).First(&errorType, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error type not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return &errorType, true
+}
+
+// SetUserRole changes a user's role
+func (h *AdminHandler) SetUserRole(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always at least one admin
+	if userID, err := GetUserID(c); err == nil && userID == targetID && req.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own admin role"})
+		return
+	}
+
+	result := h.DB.Model(&models.User{}).Where("user_id = ?", targetID).Update("role", req.Role)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditRoleChanged, targetID, "", map[string]string{"role": req.Role})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully"})
+}
+
+// ListLockouts lists recent login lockouts, newest first
+func (h *AdminHandler) ListLockouts(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	query := h.DB.Order("locked_at DESC").Limit(limit)
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+
+	var lockouts []models.LoginLockout
+	if err := query.Find(&lockouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// isUniqueViolation checks for a unique constraint error
+func isUniqueViolation(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
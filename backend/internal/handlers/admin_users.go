@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// User statuses accepted by the status filter of ListUsers
+const (
+	UserStatusActive          = "active"
+	UserStatusDisabled        = "disabled"
+	UserStatusPendingDeletion = "pending_deletion"
+)
+
+// UserPage is one page of users, newest first
+type UserPage struct {
+	Users  []models.User `json:"users"`
+	Total  int64         `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// AdminUserResponse is a user with counts of their activity
+type AdminUserResponse struct {
+	models.User
+	SessionCount int64 `json:"session_count"`
+	ErrorCount   int64 `json:"error_count"`
+}
+
+// AdminSessionResponse is a match session with its number of errors
+type AdminSessionResponse struct {
+	models.MatchSession
+	ErrorCount int64 `json:"error_count"`
+}
+
+// ListUsers lists users, optionally searched by q (username or email) and
+// filtered by role and status, with limit/offset pagination
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	query := h.DB.Model(&models.User{})
+	if q := c.Query("q"); q != "" {
+		pattern := "%" + q + "%"
+		query = query.Where("username ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		if !models.IsValidRole(role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("status") {
+	case "":
+	case UserStatusActive:
+		query = query.Where("disabled_at IS NULL AND delete_after IS NULL")
+	case UserStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	case UserStatusPendingDeletion:
+		query = query.Where("delete_after IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	page := UserPage{Limit: limit, Offset: offset}
+	if err := query.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&page.Users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUser gets a user with the number of sessions and errors they logged
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	resp := AdminUserResponse{User: *user}
+	if err := h.DB.Model(&models.MatchSession{}).Where("user_id = ?", user.UserID).
+		Count(&resp.SessionCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := h.DB.Model(&models.ErrorLog{}).
+		Joins("JOIN match_sessions ON match_sessions.session_id = error_logs.session_id").
+		Where("match_sessions.user_id = ?", user.UserID).
+		Count(&resp.ErrorCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListUserSessions lists a user's sessions, newest first, each with its
+// number of errors
+func (h *AdminHandler) ListUserSessions(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	var sessions []models.MatchSession
+	if err := h.DB.Where("user_id = ?", user.UserID).Order("start_time DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	var rows []struct {
+		SessionID uuid.UUID
+		Count     int64
+	}
+	err := h.DB.Model(&models.ErrorLog{}).
+		Select("error_logs.session_id AS session_id, COUNT(*) AS count").
+		Joins("JOIN match_sessions ON match_sessions.session_id = error_logs.session_id").
+		Where("match_sessions.user_id = ?", user.UserID).
+		Group("error_logs.session_id").
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.SessionID] = row.Count
+	}
+
+	resp := make([]AdminSessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = AdminSessionResponse{MatchSession: s, ErrorCount: counts[s.SessionID]}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DisableUser blocks an account. Its refresh tokens and devices are revoked
+// and its access and API tokens stop working at once.
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if adminID, err := GetUserID(c); err == nil && adminID == user.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+		return
+	}
+
+	if !user.IsDisabled() {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := user.Disable(tx); err != nil {
+				return err
+			}
+			return models.RevokeUserRefreshTokens(tx, user.UserID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+			return
+		}
+		recordAudit(h.DB, c, models.AuditAccountDisabled, user.UserID, "", nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled successfully"})
+}
+
+// EnableUser lifts a block set by DisableUser. The user has to sign in again.
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if user.IsDisabled() {
+		if err := user.Enable(h.DB); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+			return
+		}
+		recordAudit(h.DB, c, models.AuditAccountEnabled, user.UserID, "", nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled successfully"})
+}
+
+// ForcePasswordReset signs the user out everywhere, revokes their API
+// tokens and emails them a reset link. Until the link is used no sign-in
+// method works, including passkeys, magic links and identity providers,
+// since checkCanSignIn refuses accounts waiting for the reset.
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_reset_required", true).Error; err != nil {
+			return err
+		}
+		if err := models.RevokeUserAPITokens(tx, user.UserID); err != nil {
+			return err
+		}
+		return models.RevokeUserRefreshTokens(tx, user.UserID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to force password reset"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditResetForced, user.UserID, "", nil)
+
+	if err := h.Resets.SendResetLink(c.Request.Context(), user); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required, a reset link has been sent"})
+}
+
+// Impersonate returns an access token for the user so an admin can see the
+// app as they do. The token records the admin in its impersonator claim,
+// cannot be refreshed or used for account management, and every audit
+// event made with it names the admin as the actor.
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	adminID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	switch {
+	case user.UserID == adminID:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot impersonate yourself"})
+		return
+	case user.Role == models.RoleAdmin:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot be impersonated"})
+		return
+	case user.IsDisabled() || user.IsPendingDeletion():
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is disabled or pending deletion"})
+		return
+	}
+
+	resp, err := h.Auth.issueImpersonationToken(c, user, adminID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditImpersonated, user.UserID, "", nil)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// findUser loads the user named by the user_id parameter. It writes the
+// error response and reports false if there is none.
+func (h *AdminHandler) findUser(c *gin.Context) (*models.User, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+	return &user, true
+}
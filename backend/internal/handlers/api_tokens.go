@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// APITokenHandler manages the signed-in user's personal API tokens
+type APITokenHandler struct {
+	DB *gorm.DB
+}
+
+// CreateAPITokenRequest represents a personal API token creation request
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"` // 0 means no expiry
+}
+
+// CreateAPITokenResponse includes the token itself, which is only shown once
+type CreateAPITokenResponse struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// CreateToken creates a personal API token
+func (h *APITokenHandler) CreateToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !auth.IsKnownScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The prefix is part of the token, so hash the full value
+	secret, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	raw := auth.APITokenPrefix + secret
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: auth.HashToken(raw),
+		Prefix:    raw[:len(auth.APITokenPrefix)+6],
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditTokenCreated, userID, token.TokenID.String(), map[string]string{"name": token.Name})
+
+	c.JSON(http.StatusCreated, CreateAPITokenResponse{APIToken: token, Token: raw})
+}
+
+// ListTokens lists the user's personal API tokens
+func (h *APITokenHandler) ListTokens(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var tokens []models.APIToken
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken revokes one of the user's personal API tokens
+func (h *APITokenHandler) RevokeToken(c *gin.Context) {
+	tokenID, err := uuid.Parse(c.Param("token_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var token models.APIToken
+	if err := h.DB.Where("token_id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if token.RevokedAt == nil {
+		if err := h.DB.Model(&token).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+		recordAudit(h.DB, c, models.AuditTokenRevoked, userID, token.TokenID.String(), map[string]string{"name": token.Name})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	DB *gorm.DB
+}
+
+// AuditPage is one page of audit events, newest first
+type AuditPage struct {
+	Events []models.AuditEvent `json:"events"`
+	Total  int64               `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+// recordAudit appends an audit event for userID, which may be uuid.Nil when
+// the account is unknown. The signed-in user is recorded as the actor when
+// they act on someone else's account, and an impersonating admin always is.
+// Failures are logged, not returned, so auditing never breaks the request
+// it describes.
+func recordAudit(db *gorm.DB, c *gin.Context, action string, userID uuid.UUID, targetID string, metadata map[string]string) {
+	event := models.AuditEvent{
+		Action:    action,
+		TargetID:  targetID,
+		IP:        c.ClientIP(),
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+	if userID != uuid.Nil {
+		event.UserID = &userID
+	}
+	if actorID, err := GetUserID(c); err == nil && actorID != userID {
+		event.ActorID = &actorID
+	}
+	if adminID, ok := c.Get("impersonator_id"); ok {
+		actorID := adminID.(uuid.UUID)
+		event.ActorID = &actorID
+	}
+
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record audit event %s: %v", action, err)
+	}
+}
+
+// ListMine lists the current user's audit events
+func (h *AuditHandler) ListMine(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	h.listEvents(c, h.DB.Where("user_id = ?", userID))
+}
+
+// ListAll lists audit events for all users. It can be filtered by user_id,
+// actor_id, action, ip, since and until (RFC 3339).
+func (h *AuditHandler) ListAll(c *gin.Context) {
+	query := h.DB
+	for _, param := range []string{"user_id", "actor_id"} {
+		if v := c.Query(param); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			query = query.Where(param+" = ?", id)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since"})
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if until := c.Query("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until"})
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	h.listEvents(c, query)
+}
+
+// listEvents responds with one page of the events matching query, using the
+// limit and offset query parameters
+func (h *AuditHandler) listEvents(c *gin.Context, query *gorm.DB) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	// A new session lets the query be reused for the count and the page
+	query = query.Session(&gorm.Session{})
+	page := AuditPage{Limit: limit, Offset: offset}
+	if err := query.Model(&models.AuditEvent{}).Count(&page.Total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit events"})
+		return
+	}
+	if err := query.Order("created_at DESC, event_id").Limit(limit).Offset(offset).Find(&page.Events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -1,33 +1,44 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/jimsyyap/error_app/backend/internal/throttle"
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
 	"github.com/jimsyyap/error_app/backend/pkg/models"
 )
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	DB     *gorm.DB
-	Secret string
-	Expiry int // JWT expiration in hours
+	DB            *gorm.DB
+	Keys          *auth.Keyring
+	AccessExpiry  int // access token expiration in minutes
+	RefreshExpiry int // refresh token expiration in hours
+	Passwords     *auth.PasswordHasher
+
+	Verifier        *VerificationHandler // sends verification emails on registration
+	RequireVerified bool                 // reject logins from unverified users
+
+	AccountThrottle *throttle.Throttle // failed logins per account
+	IPThrottle      *throttle.Throttle // failed logins per client IP
 }
 
 // RegisterRequest represents the user registration request
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=50"`
+	Username string `json:"username" binding:"required,min=3,max=50,excludes=@"` // no @ so it cannot pass for an email
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
 }
 
-// LoginRequest represents the user login request
+// LoginRequest represents the user login request. Username may also be the
+// account's email address.
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -35,7 +46,9 @@ type LoginRequest struct {
 
 // TokenResponse represents the JWT token response
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"` // not issued for impersonation
+	ExpiresIn    int64  `json:"expires_in"`              // access token lifetime in seconds
 }
 
 // Register handles user registration
@@ -48,7 +61,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Check if username already exists
 	var existingUser models.User
-	result := h.DB.Where("username = ?", req.Username).First(&existingUser)
+	result := h.DB.Scopes(models.WithUsername(req.Username)).First(&existingUser)
 	if result.Error == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
 		return
@@ -58,7 +71,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if email already exists
-	result = h.DB.Where("email = ?", req.Email).First(&existingUser)
+	result = h.DB.Scopes(models.WithEmail(req.Email)).First(&existingUser)
 	if result.Error == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 		return
@@ -68,7 +81,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.Passwords.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -78,15 +91,29 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	user := models.User{
 		Username:     req.Username,
 		Email:        req.Email,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		CreatedAt:    time.Now(),
 	}
 
 	if err := h.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		// Someone registered the same name or address in the meantime
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		}
 		return
 	}
 
+	recordAudit(h.DB, c, models.AuditRegister, user.UserID, "", nil)
+
+	// Send the verification email; the user can ask for another if it fails
+	if h.Verifier != nil {
+		if err := h.Verifier.SendVerification(c.Request.Context(), &user); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
 }
 
@@ -98,37 +125,176 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Find user by username
-	var user models.User
-	if err := h.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+	user, ok := h.authenticate(c, req.Username, req.Password)
+	if !ok {
 		return
 	}
 
-	// Compare passwords
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+	if !checkCanSignIn(c, user) {
 		return
 	}
 
-	// Update last login
-	user.UpdateLastLogin(h.DB)
+	if h.RequireVerified && !user.IsVerified() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
 
-	// Generate JWT token
-	expirationTime := time.Now().Add(time.Duration(h.Expiry) * time.Hour)
-	claims := jwt.MapClaims{
-		"user_id": user.UserID.String(),
-		"exp":     expirationTime.Unix(),
+	// Users with a second factor get a challenge instead of tokens
+	mfaEnabled, err := h.hasMFA(user.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if mfaEnabled {
+		h.startMFAChallenge(c, user)
+		return
 	}
+	h.recordLoginSuccess(accountSubject(user))
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(h.Secret))
+	// Update last login
+	user.UpdateLastLogin(h.DB)
+
+	// Issue an access token and start a new refresh family
+	resp, err := h.issueTokens(c, h.DB, user, uuid.New())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	recordAudit(h.DB, c, models.AuditLogin, user.UserID, "", map[string]string{"method": "password"})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RestoreAccount cancels a pending account deletion. It takes the same
+// credentials as Login and is throttled the same way.
+func (h *AuthHandler) RestoreAccount(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.authenticate(c, req.Username, req.Password)
+	if !ok {
+		return
+	}
+
+	if !user.IsPendingDeletion() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not scheduled for deletion"})
+		return
+	}
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
 
-	c.JSON(http.StatusOK, TokenResponse{Token: tokenString})
+	h.recordLoginSuccess(accountSubject(user))
+
+	if err := user.CancelDeletion(h.DB); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditAccountRestored, user.UserID, "", nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored successfully"})
+}
+
+// authenticate checks a username or email and a password, applying the
+// login throttles. It writes the error response and reports false on
+// failure. The account's failures are not cleared here since a second
+// factor may still be due; callers do that once sign-in is complete.
+func (h *AuthHandler) authenticate(c *gin.Context, username, password string) (*models.User, bool) {
+	// Usernames cannot contain @, so anything with one is an email
+	lookup := models.WithUsername(username)
+	if strings.Contains(username, "@") {
+		lookup = models.WithEmail(username)
+	}
+	var user models.User
+	err := h.DB.Scopes(lookup).First(&user).Error
+	subject := unknownAccountSubject(username)
+	if err == nil {
+		subject = accountSubject(&user)
+	}
+
+	// Refuse to evaluate passwords while the account or IP is locked out
+	if !h.checkLoginThrottles(c, subject) {
+		recordAudit(h.DB, c, models.AuditLoginFailed, uuid.Nil, "", map[string]string{"username": username, "reason": "locked_out"})
+		return nil, false
+	}
+
+	if err != nil {
+		h.recordLoginFailure(subject, c.ClientIP())
+		recordAudit(h.DB, c, models.AuditLoginFailed, uuid.Nil, "", map[string]string{"username": username, "reason": "unknown_user"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return nil, false
+	}
+
+	// Compare passwords
+	ok, needsRehash, err := h.Passwords.Verify(password, user.PasswordHash)
+	if err != nil {
+		log.Printf("Failed to verify password of user %s: %v", user.UserID, err)
+	}
+	if !ok {
+		h.recordLoginFailure(subject, c.ClientIP())
+		recordAudit(h.DB, c, models.AuditLoginFailed, user.UserID, "", map[string]string{"reason": "bad_password"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return nil, false
+	}
+
+	// An admin has asked for a new password; only a reset link works now
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, use the link sent by email"})
+		return nil, false
+	}
+
+	// Move the stored hash to the current algorithm and cost
+	if needsRehash {
+		if err := h.rehashPassword(&user, password); err != nil {
+			log.Printf("Failed to rehash password of user %s: %v", user.UserID, err)
+		}
+	}
+
+	return &user, true
+}
+
+// checkCanSignIn responds with 403 and reports false if the account is
+// disabled, pending deletion or waiting for a forced password reset. Every
+// sign-in method checks it before issuing tokens.
+func checkCanSignIn(c *gin.Context, user *models.User) bool {
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return false
+	}
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, use the link sent by email"})
+		return false
+	}
+	if user.IsPendingDeletion() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":        "Account is scheduled for deletion, restore it to sign in",
+			"delete_after": user.DeleteAfter,
+		})
+		return false
+	}
+	return true
+}
+
+// rehashPassword replaces the user's stored hash with one made under the
+// current policy. The update only applies if the hash is still the one that
+// was verified, so a concurrent password change is not overwritten.
+func (h *AuthHandler) rehashPassword(user *models.User, password string) error {
+	hash, err := h.Passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	err = h.DB.Model(&models.User{}).
+		Where("user_id = ? AND password_hash = ?", user.UserID, user.PasswordHash).
+		Update("password_hash", hash).Error
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return nil
 }
 
 // GetUserID extracts the user ID from the context
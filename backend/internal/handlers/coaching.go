@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// CoachingHandler handles coach–player links and coach access to player data
+type CoachingHandler struct {
+	DB *gorm.DB
+}
+
+// CoachLinkRequest invites a coach or a player. Set exactly one username;
+// the caller takes the other side of the link.
+type CoachLinkRequest struct {
+	CoachUsername  string `json:"coach_username"`
+	PlayerUsername string `json:"player_username"`
+	Permission     string `json:"permission"`
+}
+
+// PermissionRequest represents a coach link permission change
+type PermissionRequest struct {
+	Permission string `json:"permission" binding:"required"`
+}
+
+// AnnotationRequest represents a coach annotation on a session
+type AnnotationRequest struct {
+	Body    string     `json:"body" binding:"required,max=2000"`
+	ErrorID *uuid.UUID `json:"error_id"`
+}
+
+// CoachLinkResponse is a coach link with both parties' usernames
+type CoachLinkResponse struct {
+	models.CoachLink
+	CoachUsername  string `json:"coach_username"`
+	PlayerUsername string `json:"player_username"`
+}
+
+// Coaching errors
+var (
+	ErrNoCoachLink    = errors.New("no active coach link")
+	ErrCannotAnnotate = errors.New("coach link does not allow annotating")
+)
+
+// Invite creates a pending link between the caller and another user
+func (h *CoachingHandler) Invite(c *gin.Context) {
+	var req CoachLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.CoachUsername == "") == (req.PlayerUsername == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either coach_username or player_username"})
+		return
+	}
+	if req.Permission == "" {
+		req.Permission = models.PermissionView
+	}
+	if !models.IsValidPermission(req.Permission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	targetName := req.PlayerUsername
+	if req.CoachUsername != "" {
+		targetName = req.CoachUsername
+	}
+	var target models.User
+	if err := h.DB.Scopes(models.WithUsername(targetName)).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if target.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot link to yourself"})
+		return
+	}
+
+	link := models.CoachLink{
+		InvitedBy:  userID,
+		Status:     models.LinkPending,
+		Permission: req.Permission,
+		CreatedAt:  time.Now(),
+	}
+	if req.PlayerUsername != "" {
+		// The caller is the coach
+		if !isCoachRole(c.GetString("role")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only coaches can invite players"})
+			return
+		}
+		link.CoachID, link.PlayerID = userID, target.UserID
+	} else {
+		// The caller is the player
+		if !isCoachRole(target.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "That user is not a coach"})
+			return
+		}
+		link.CoachID, link.PlayerID = target.UserID, userID
+	}
+
+	var existing int64
+	if err := h.DB.Model(&models.CoachLink{}).
+		Where("coach_id = ? AND player_id = ? AND status <> ?", link.CoachID, link.PlayerID, models.LinkRevoked).
+		Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A link between these users already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// ListLinks lists the caller's pending and active links, as coach or player
+func (h *CoachingHandler) ListLinks(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var links []models.CoachLink
+	if err := h.DB.Preload("Coach").Preload("Player").
+		Where("(coach_id = ? OR player_id = ?) AND status <> ?", userID, userID, models.LinkRevoked).
+		Order("created_at DESC").
+		Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve links"})
+		return
+	}
+
+	resp := make([]CoachLinkResponse, len(links))
+	for i, link := range links {
+		resp[i] = CoachLinkResponse{
+			CoachLink:      link,
+			CoachUsername:  link.Coach.Username,
+			PlayerUsername: link.Player.Username,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// AcceptLink accepts an invitation sent to the caller
+func (h *CoachingHandler) AcceptLink(c *gin.Context) {
+	link, userID, ok := h.findLink(c)
+	if !ok {
+		return
+	}
+
+	if link.InvitedBy == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the invited user can accept a link"})
+		return
+	}
+	if link.Status != models.LinkPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link is not pending"})
+		return
+	}
+
+	now := time.Now()
+	if err := h.DB.Model(link).Updates(map[string]interface{}{
+		"status":      models.LinkActive,
+		"accepted_at": now,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// RevokeLink ends a link or declines an invitation. Either side may do so.
+func (h *CoachingHandler) RevokeLink(c *gin.Context) {
+	link, _, ok := h.findLink(c)
+	if !ok {
+		return
+	}
+
+	if link.Status == models.LinkRevoked {
+		c.JSON(http.StatusOK, gin.H{"message": "Link revoked successfully"})
+		return
+	}
+
+	if err := h.DB.Model(link).Updates(map[string]interface{}{
+		"status":     models.LinkRevoked,
+		"revoked_at": time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Link revoked successfully"})
+}
+
+// SetLinkPermission changes what a coach may do. Only the player can.
+func (h *CoachingHandler) SetLinkPermission(c *gin.Context) {
+	var req PermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidPermission(req.Permission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission"})
+		return
+	}
+
+	link, userID, ok := h.findLink(c)
+	if !ok {
+		return
+	}
+	if link.PlayerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the player can change permissions"})
+		return
+	}
+	if link.Status == models.LinkRevoked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link has been revoked"})
+		return
+	}
+
+	if err := h.DB.Model(link).Update("permission", req.Permission).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// ListPlayerSessions lists a linked player's sessions
+func (h *CoachingHandler) ListPlayerSessions(c *gin.Context) {
+	playerID, ok := h.authorizePlayer(c, false)
+	if !ok {
+		return
+	}
+
+	var sessions []models.MatchSession
+	if err := h.DB.Where("user_id = ?", playerID).Order("start_time DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// ListPlayerErrors lists the errors logged in a linked player's session
+func (h *CoachingHandler) ListPlayerErrors(c *gin.Context) {
+	session, ok := h.playerSession(c, false)
+	if !ok {
+		return
+	}
+
+	var errorLogs []models.ErrorLog
+	if err := h.DB.Preload("ErrorType").Where("session_id = ?", session.SessionID).
+		Order("timestamp ASC").Find(&errorLogs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve errors"})
+		return
+	}
+
+	c.JSON(http.StatusOK, errorLogs)
+}
+
+// GetPlayerSummary gets the error summary of a linked player's session
+func (h *CoachingHandler) GetPlayerSummary(c *gin.Context) {
+	session, ok := h.playerSession(c, false)
+	if !ok {
+		return
+	}
+
+	summary, err := buildSummary(h.DB, session.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetPlayerErrorPivot counts the errors of a linked player's session by two
+// dimensions, like GetErrorPivot
+func (h *CoachingHandler) GetPlayerErrorPivot(c *gin.Context) {
+	rows, columns, ok := pivotDimensions(c)
+	if !ok {
+		return
+	}
+
+	session, ok := h.playerSession(c, false)
+	if !ok {
+		return
+	}
+
+	pivot, err := buildErrorPivot(h.DB, session.SessionID, rows, columns)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pivot)
+}
+
+// GetPlayerOutcomeSummary gets the point outcome summary of a linked
+// player's session
+func (h *CoachingHandler) GetPlayerOutcomeSummary(c *gin.Context) {
+	session, ok := h.playerSession(c, false)
+	if !ok {
+		return
+	}
+
+	summary, err := buildOutcomeSummary(h.DB, session.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ListPlayerAnnotations lists the annotations on a linked player's session
+func (h *CoachingHandler) ListPlayerAnnotations(c *gin.Context) {
+	session, ok := h.playerSession(c, false)
+	if !ok {
+		return
+	}
+	h.listAnnotations(c, session.SessionID)
+}
+
+// AddAnnotation adds a coach note to a linked player's session. The link
+// must grant the annotate permission.
+func (h *CoachingHandler) AddAnnotation(c *gin.Context) {
+	var req AnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, ok := h.playerSession(c, true)
+	if !ok {
+		return
+	}
+
+	if req.ErrorID != nil {
+		var count int64
+		if err := h.DB.Model(&models.ErrorLog{}).
+			Where("error_id = ? AND session_id = ?", *req.ErrorID, session.SessionID).
+			Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error not found in this session"})
+			return
+		}
+	}
+
+	coachID, _ := GetUserID(c)
+	annotation := models.SessionAnnotation{
+		SessionID: session.SessionID,
+		ErrorID:   req.ErrorID,
+		AuthorID:  coachID,
+		Body:      req.Body,
+		CreatedAt: time.Now(),
+	}
+	if err := h.DB.Create(&annotation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add annotation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, annotation)
+}
+
+// ListOwnAnnotations lists coach annotations on one of the caller's sessions
+func (h *CoachingHandler) ListOwnAnnotations(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var session models.MatchSession
+	if err := h.DB.Where("session_id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	h.listAnnotations(c, session.SessionID)
+}
+
+func (h *CoachingHandler) listAnnotations(c *gin.Context, sessionID uuid.UUID) {
+	var annotations []models.SessionAnnotation
+	if err := h.DB.Where("session_id = ?", sessionID).Order("created_at ASC").Find(&annotations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve annotations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, annotations)
+}
+
+// findLink loads the link in the URL and checks the caller is a party to it
+func (h *CoachingHandler) findLink(c *gin.Context) (*models.CoachLink, uuid.UUID, bool) {
+	linkID, err := uuid.Parse(c.Param("link_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return nil, uuid.Nil, false
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, uuid.Nil, false
+	}
+
+	var link models.CoachLink
+	if err := h.DB.First(&link, "link_id = ?", linkID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, uuid.Nil, false
+	}
+	if !link.IsParty(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return nil, uuid.Nil, false
+	}
+
+	return &link, userID, true
+}
+
+// authorizePlayer checks that the caller has an active link to the player
+// in the URL, with the annotate permission if needed
+func (h *CoachingHandler) authorizePlayer(c *gin.Context, annotate bool) (uuid.UUID, bool) {
+	playerID, err := uuid.Parse(c.Param("player_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid player ID"})
+		return uuid.Nil, false
+	}
+
+	coachID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, false
+	}
+
+	switch err := authorizeCoach(h.DB, coachID, playerID, annotate); {
+	case err == nil:
+		return playerID, true
+	case errors.Is(err, ErrNoCoachLink):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+	case errors.Is(err, ErrCannotAnnotate):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Player has not allowed you to annotate"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+	return uuid.Nil, false
+}
+
+// playerSession authorizes the caller for the player in the URL and loads
+// the session in the URL, scoped to that player
+func (h *CoachingHandler) playerSession(c *gin.Context, annotate bool) (*models.MatchSession, bool) {
+	playerID, ok := h.authorizePlayer(c, annotate)
+	if !ok {
+		return nil, false
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return nil, false
+	}
+
+	var session models.MatchSession
+	if err := h.DB.Where("session_id = ? AND user_id = ?", sessionID, playerID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return &session, true
+}
+
+// authorizeCoach checks for an active link from coach to player
+func authorizeCoach(db *gorm.DB, coachID, playerID uuid.UUID, annotate bool) error {
+	var link models.CoachLink
+	err := db.Where("coach_id = ? AND player_id = ? AND status = ?", coachID, playerID, models.LinkActive).
+		First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoCoachLink
+	} else if err != nil {
+		return err
+	}
+	if annotate && !link.CanAnnotate() {
+		return ErrCannotAnnotate
+	}
+	return nil
+}
+
+// isCoachRole checks if a role may act as a coach
+func isCoachRole(role string) bool {
+	return role == models.RoleCoach || role == models.RoleAdmin
+}
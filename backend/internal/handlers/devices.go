@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// DeviceHandler handles the user's signed-in devices
+type DeviceHandler struct {
+	DB *gorm.DB
+}
+
+// DeviceResponse is a device session flagged if it made the request
+type DeviceResponse struct {
+	models.DeviceSession
+	Current bool `json:"current"`
+}
+
+// ListDevices lists the devices the user is signed in on, most recently
+// used first
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var devices []models.DeviceSession
+	if err := h.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_seen_at DESC").Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve devices"})
+		return
+	}
+
+	current, _ := c.Get("device_id")
+	resp := make([]DeviceResponse, len(devices))
+	for i, d := range devices {
+		resp[i] = DeviceResponse{DeviceSession: d, Current: d.DeviceID == current}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeDevice signs out one of the user's devices. Its access token stops
+// working at once and its refresh token can no longer be used.
+func (h *DeviceHandler) RevokeDevice(c *gin.Context) {
+	deviceID, err := uuid.Parse(c.Param("device_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var device models.DeviceSession
+	if err := h.DB.Where("device_id = ? AND user_id = ?", deviceID, userID).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if !device.IsRevoked() {
+		if err := models.RevokeRefreshFamily(h.DB, device.DeviceID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+			return
+		}
+		recordAudit(h.DB, c, models.AuditDeviceRevoked, userID, device.DeviceID.String(), map[string]string{"user_agent": device.UserAgent})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device signed out successfully"})
+}
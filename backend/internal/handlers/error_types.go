@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// ErrInvalidColor is returned for an error type color that is not #rrggbb
+var ErrInvalidColor = errors.New("color must be #rrggbb")
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// CreateErrorType adds a custom error type of the user's own, visible only
+// to them on top of the global types
+func (h *ErrorHandler) CreateErrorType(c *gin.Context) {
+	var req ErrorTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	saveErrorType(c, h.DB, &models.ErrorType{UserID: &userID}, &req)
+}
+
+// UpdateErrorType changes one of the user's own error types
+func (h *ErrorHandler) UpdateErrorType(c *gin.Context) {
+	var req ErrorTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errorType, ok := h.findOwnErrorType(c)
+	if !ok {
+		return
+	}
+
+	saveErrorType(c, h.DB, errorType, &req)
+}
+
+// ArchiveErrorType archives one of the user's own error types. Errors
+// logged with it stay valid but no new ones can be.
+func (h *ErrorHandler) ArchiveErrorType(c *gin.Context) {
+	errorType, ok := h.findOwnErrorType(c)
+	if !ok {
+		return
+	}
+
+	setErrorTypeArchived(c, h.DB, errorType, true)
+}
+
+// RestoreErrorType brings back one of the user's archived error types
+func (h *ErrorHandler) RestoreErrorType(c *gin.Context) {
+	errorType, ok := h.findOwnErrorType(c)
+	if !ok {
+		return
+	}
+
+	setErrorTypeArchived(c, h.DB, errorType, false)
+}
+
+// findOwnErrorType loads the user's own error type in the URL
+func (h *ErrorHandler) findOwnErrorType(c *gin.Context) (*models.ErrorType, bool) {
+	id, err := strconv.Atoi(c.Param("error_type_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid error type ID"})
+		return nil, false
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var errorType models.ErrorType
+	if err := h.DB.Where("user_id = ?", userID).First(&errorType, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error type not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return &errorType, true
+}
+
+// saveErrorType applies the request to a new or existing error type, saves
+// it and writes the response. The type's organization or user must already
+// be set.
+func saveErrorType(c *gin.Context, db *gorm.DB, errorType *models.ErrorType, req *ErrorTypeRequest) {
+	creating := errorType.ErrorTypeID == 0
+
+	errorType.Name = req.Name
+	if req.Position != nil {
+		errorType.Position = *req.Position
+	}
+	if req.Color != nil {
+		if *req.Color == "" {
+			errorType.Color = nil
+		} else if colorPattern.MatchString(*req.Color) {
+			color := strings.ToLower(*req.Color)
+			errorType.Color = &color
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidColor.Error()})
+			return
+		}
+	}
+	if req.Attributes != nil {
+		errorType.Attributes = req.Attributes
+	} else if creating {
+		errorType.Attributes = models.AllAttributes
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			errorType.ParentID = nil
+		} else if err := checkParent(db, errorType, *req.ParentID); err != nil {
+			if errors.Is(err, models.ErrInvalidParent) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		} else {
+			errorType.ParentID = req.ParentID
+		}
+	}
+
+	var err error
+	if creating {
+		err = db.Create(errorType).Error
+	} else {
+		err = db.Model(errorType).Select("name", "parent_id", "position", "color", "attributes").Updates(errorType).Error
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Error type already exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save error type"})
+		}
+		return
+	}
+
+	if creating {
+		c.JSON(http.StatusCreated, errorType)
+	} else {
+		c.JSON(http.StatusOK, errorType)
+	}
+}
+
+// checkParent checks an error type can be placed under parentID: the parent
+// must be visible wherever the type is and not archived, and the type must
+// not end up among its own ancestors. Moving a type moves its subtypes too,
+// so none of them may end up nested too deep either.
+func checkParent(db *gorm.DB, errorType *models.ErrorType, parentID int) error {
+	height, err := subtreeHeight(db, errorType.ErrorTypeID)
+	if err != nil {
+		return err
+	}
+
+	scope := visibleErrorTypes(errorType.OrgID, errorType.UserID)
+	id := parentID
+	for depth := 1; ; depth++ {
+		if depth+height > models.MaxErrorTypeDepth || id == errorType.ErrorTypeID {
+			return models.ErrInvalidParent
+		}
+
+		var ancestor models.ErrorType
+		if err := db.Scopes(scope).First(&ancestor, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.ErrInvalidParent
+			}
+			return err
+		}
+		if id == parentID && ancestor.IsArchived() {
+			return models.ErrInvalidParent
+		}
+		if ancestor.ParentID == nil {
+			return nil
+		}
+		id = *ancestor.ParentID
+	}
+}
+
+// subtreeHeight counts the levels of subtypes below an error type, of any
+// owner and archived or not. A new type has none.
+func subtreeHeight(db *gorm.DB, errorTypeID int) (int, error) {
+	if errorTypeID == 0 {
+		return 0, nil
+	}
+
+	level := []int{errorTypeID}
+	height := 0
+	for ; height <= models.MaxErrorTypeDepth; height++ {
+		var children []int
+		if err := db.Model(&models.ErrorType{}).Where("parent_id IN ?", level).
+			Pluck("error_type_id", &children).Error; err != nil {
+			return 0, err
+		}
+		if len(children) == 0 {
+			break
+		}
+		level = children
+	}
+	return height, nil
+}
+
+// setErrorTypeArchived archives or restores an error type and writes the
+// response
+func setErrorTypeArchived(c *gin.Context, db *gorm.DB, errorType *models.ErrorType, archived bool) {
+	var err error
+	switch {
+	case archived && !errorType.IsArchived():
+		err = errorType.Archive(db)
+	case !archived && errorType.IsArchived():
+		err = errorType.Restore(db)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update error type"})
+		return
+	}
+
+	c.JSON(http.StatusOK, errorType)
+}
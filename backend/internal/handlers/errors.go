@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,6 +22,19 @@ type ErrorHandler struct {
 type ErrorLogRequest struct {
 	SessionID   uuid.UUID `json:"session_id" binding:"required"`
 	ErrorTypeID int       `json:"error_type_id" binding:"required"`
+	PointContextRequest
+	models.ErrorAttributes
+}
+
+// PointContextRequest places a logged event in the match for sessions that
+// are not being scored. Scored sessions derive it from the score.
+type PointContextRequest struct {
+	SetNumber   *int    `json:"set_number" binding:"omitempty,min=1,max=5"`
+	GameNumber  *int    `json:"game_number" binding:"omitempty,min=1,max=100"`
+	PointNumber *int    `json:"point_number" binding:"omitempty,min=1,max=100"`
+	Server      *string `json:"server" binding:"omitempty,oneof=player opponent"`
+	BreakPoint  *bool   `json:"break_point"`
+	SetPoint    *bool   `json:"set_point"`
 }
 
 // Common errors
@@ -29,6 +43,7 @@ var (
 	ErrSessionNotFound = errors.New("session not found")
 	ErrNotActiveSession = errors.New("session is not active")
 	ErrErrorTypeNotFound = errors.New("error type not found")
+	ErrBreakPointServer = errors.New("server is required for a break point")
 )
 
 // LogError logs a new error
@@ -39,6 +54,11 @@ func (h *ErrorHandler) LogError(c *gin.Context) {
 		return
 	}
 
+	if err := req.PointContextRequest.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	userID, err := GetUserID(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -62,9 +82,9 @@ func (h *ErrorHandler) LogError(c *gin.Context) {
 		return
 	}
 
-	// Verify error type exists
+	// Verify error type exists and is global or belongs to the session's organization or user
 	var errorType models.ErrorType
-	if err := h.DB.First(&errorType, req.ErrorTypeID).Error; err != nil {
+	if err := h.DB.Scopes(visibleErrorTypes(session.OrgID, &session.UserID)).First(&errorType, req.ErrorTypeID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Error type not found"})
 		} else {
@@ -72,12 +92,29 @@ func (h *ErrorHandler) LogError(c *gin.Context) {
 		}
 		return
 	}
+	if errorType.IsArchived() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error type is archived"})
+		return
+	}
+
+	if err := req.ErrorAttributes.Validate(&errorType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pointContext, err := req.PointContextRequest.resolve(h.DB, &session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute score"})
+		return
+	}
 
 	// Create error log
 	errorLog := models.ErrorLog{
-		SessionID:   req.SessionID,
-		ErrorTypeID: req.ErrorTypeID,
-		Timestamp:   time.Now(),
+		SessionID:       req.SessionID,
+		ErrorTypeID:     req.ErrorTypeID,
+		Timestamp:       time.Now(),
+		PointContext:    pointContext,
+		ErrorAttributes: req.ErrorAttributes,
 	}
 
 	if err := h.DB.Create(&errorLog).Error; err != nil {
@@ -137,17 +174,113 @@ func (h *ErrorHandler) UndoLastError(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to undo error"})
 		return
 	}
+	recordAudit(h.DB, c, models.AuditErrorUndone, userID, lastError.ErrorID.String(), map[string]string{
+		"session_id":    req.SessionID.String(),
+		"error_type_id": strconv.Itoa(lastError.ErrorTypeID),
+	})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Last error undone successfully"})
 }
 
-// GetErrorTypes gets all error types
+// GetErrorTypes gets the global error types and the user's own, plus an
+// organization's custom types when ?org_id= names one the user belongs to.
+// Archived types are left out unless ?include_archived=true.
 func (h *ErrorHandler) GetErrorTypes(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var orgID *uuid.UUID
+	if orgParam := c.Query("org_id"); orgParam != "" {
+		id, err := uuid.Parse(orgParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+			return
+		}
+
+		if _, err := findMembership(h.DB, id, userID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+		orgID = &id
+	}
+
 	var errorTypes []models.ErrorType
-	if err := h.DB.Find(&errorTypes).Error; err != nil {
+	if err := h.DB.Scopes(visibleErrorTypes(orgID, &userID), archivedErrorTypes(c)).
+		Order("position, error_type_id").Find(&errorTypes).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve error types"})
 		return
 	}
 
 	c.JSON(http.StatusOK, errorTypes)
 }
+
+// Validate checks a break point names the server, without which it is
+// meaningless
+func (r PointContextRequest) Validate() error {
+	if r.BreakPoint != nil && *r.BreakPoint && r.Server == nil {
+		return ErrBreakPointServer
+	}
+	return nil
+}
+
+// resolve returns the point context of an event logged now. For a scored
+// session it is the point being played, or none once the match is over;
+// otherwise it is what the request gave.
+func (r PointContextRequest) resolve(db *gorm.DB, session *models.MatchSession) (models.PointContext, error) {
+	if !session.IsScored() {
+		return models.PointContext{
+			SetNumber:   r.SetNumber,
+			GameNumber:  r.GameNumber,
+			PointNumber: r.PointNumber,
+			Server:      r.Server,
+			BreakPoint:  r.BreakPoint,
+			SetPoint:    r.SetPoint,
+		}, nil
+	}
+
+	state, err := models.ReplayScore(db, session)
+	if err != nil {
+		return models.PointContext{}, err
+	}
+	next, ok := state.Next()
+	if !ok {
+		return models.PointContext{}, nil
+	}
+	return models.NewPointContext(next), nil
+}
+
+// visibleErrorTypes limits a query to the global error types and, if set,
+// the custom types of orgID and userID
+func visibleErrorTypes(orgID, userID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		query := "(error_types.org_id IS NULL AND error_types.user_id IS NULL)"
+		var args []interface{}
+		if orgID != nil {
+			query += " OR error_types.org_id = ?"
+			args = append(args, *orgID)
+		}
+		if userID != nil {
+			query += " OR error_types.user_id = ?"
+			args = append(args, *userID)
+		}
+		return db.Where(query, args...)
+	}
+}
+
+// archivedErrorTypes leaves archived error types out of a listing unless
+// ?include_archived=true
+func archivedErrorTypes(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if c.Query("include_archived") == "true" {
+			return db
+		}
+		return db.Where("error_types.archived_at IS NULL")
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// checkLoginThrottles responds with 429 and reports false if the account
+// subject or client IP is currently locked out
+func (h *AuthHandler) checkLoginThrottles(c *gin.Context, subject string) bool {
+	var wait time.Duration
+	if h.AccountThrottle != nil {
+		d, err := h.AccountThrottle.Check(subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		wait = d
+	}
+	if h.IPThrottle != nil {
+		d, err := h.IPThrottle.Check(c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		setRetryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed login against the account and the IP
+func (h *AuthHandler) recordLoginFailure(subject, ip string) {
+	if h.AccountThrottle != nil {
+		if _, err := h.AccountThrottle.Fail(subject); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+	}
+	if h.IPThrottle != nil {
+		if _, err := h.IPThrottle.Fail(ip); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+	}
+}
+
+// recordLoginSuccess clears the account's failure count. The IP count is
+// left to expire on its own so one valid account cannot reset it.
+func (h *AuthHandler) recordLoginSuccess(subject string) {
+	if h.AccountThrottle != nil {
+		if err := h.AccountThrottle.Reset(subject); err != nil {
+			log.Printf("Failed to reset login throttle: %v", err)
+		}
+	}
+}
+
+// verifyCurrentPassword re-confirms the password of a signed-in user before
+// a sensitive change. Failures count towards the same lockout as logins so
+// the check cannot be used to guess the password. It writes the error
+// response, with message for a wrong password, and reports false on failure.
+func (h *AuthHandler) verifyCurrentPassword(c *gin.Context, user *models.User, password, message string) bool {
+	subject := accountSubject(user)
+	if !h.checkLoginThrottles(c, subject) {
+		return false
+	}
+
+	ok, _, err := h.Passwords.Verify(password, user.PasswordHash)
+	if err != nil {
+		log.Printf("Failed to verify password of user %s: %v", user.UserID, err)
+	}
+	if !ok {
+		h.recordLoginFailure(subject, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		return false
+	}
+	h.recordLoginSuccess(subject)
+	return true
+}
+
+// accountSubject is the account throttle subject of a user, so failures
+// count together whether the username or the email was typed
+func accountSubject(user *models.User) string {
+	return "user:" + user.UserID.String()
+}
+
+// unknownAccountSubject is the account throttle subject of a name that
+// matches no account. Such names lock out too so lockouts do not reveal
+// which accounts exist.
+func unknownAccountSubject(username string) string {
+	return "name:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/internal/throttle"
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/mailer"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// MagicLinkHandler handles passwordless sign-in by email
+type MagicLinkHandler struct {
+	DB      *gorm.DB
+	Auth    *AuthHandler // issues the tokens once a link is used
+	Mailer  mailer.Mailer
+	BaseURL string // frontend URL the sign-in link points to
+	Expiry  int    // link expiration in minutes
+
+	// Every link request counts as an attempt, so these limit how many
+	// links can be sent to one address or from one client IP
+	EmailThrottle *throttle.Throttle
+	IPThrottle    *throttle.Throttle
+}
+
+// MagicLinkRequest represents a request for a sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ErrInvalidMagicLink is returned for unknown, used or expired sign-in links
+var ErrInvalidMagicLink = errors.New("invalid magic link")
+
+// RequestLink emails a sign-in link. The response is the same whether or
+// not the email belongs to an account.
+func (h *MagicLinkHandler) RequestLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.allowRequest(c, strings.ToLower(req.Email)) {
+		return
+	}
+
+	accepted := gin.H{"message": "If the email is registered, a sign-in link has been sent"}
+
+	var user models.User
+	if err := h.DB.Scopes(models.WithEmail(req.Email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusAccepted, accepted)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Accounts pending deletion must be restored with their password first,
+	// and disabled accounts cannot sign in at all
+	if user.IsPendingDeletion() || user.IsDisabled() {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sign-in link"})
+		return
+	}
+
+	// Only the most recent link stays valid
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.InvalidateMagicLinks(tx, user.UserID); err != nil {
+			return err
+		}
+		return tx.Create(&models.MagicLinkToken{
+			UserID:    user.UserID,
+			TokenHash: hash,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Duration(h.Expiry) * time.Minute),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sign-in link"})
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Sign in to Tennis Error Tracker",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to sign in. It works once and expires in %d minutes.\n\n%s/login/magic/%s\n\nIf you did not ask to sign in you can ignore this email.\n",
+			user.Username, h.Expiry, h.BaseURL, url.PathEscape(token)),
+	}
+	// Answering 500 here would reveal that the account exists
+	if err := h.Mailer.Send(c.Request.Context(), msg); err != nil {
+		log.Printf("Failed to send sign-in link: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// ExchangeLink signs in with a link from RequestLink and returns the same
+// response as Login, including an MFA challenge when a second factor is set
+func (h *MagicLinkHandler) ExchangeLink(c *gin.Context) {
+	var link models.MagicLinkToken
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", auth.HashToken(c.Param("token"))).First(&link).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidMagicLink
+			}
+			return err
+		}
+
+		if link.IsExpired() {
+			return ErrInvalidMagicLink
+		}
+		ok, err := link.Consume(tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMagicLink
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidMagicLink) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in link"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", link.UserID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !checkCanSignIn(c, &user) {
+		return
+	}
+
+	// Following the link proves the user controls the address
+	if !user.IsVerified() {
+		if err := user.MarkVerified(h.DB); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	// A second factor still applies to passwordless logins
+	mfaEnabled, err := h.Auth.hasMFA(user.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if mfaEnabled {
+		h.Auth.startMFAChallenge(c, &user)
+		return
+	}
+
+	user.UpdateLastLogin(h.DB)
+
+	resp, err := h.Auth.issueTokens(c, h.DB, &user, uuid.New())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditLogin, user.UserID, "", map[string]string{"method": "magic_link"})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// allowRequest counts a link request against the email and the client IP
+// and responds with 429 if either has sent too many
+func (h *MagicLinkHandler) allowRequest(c *gin.Context, email string) bool {
+	for _, limit := range []struct {
+		throttle *throttle.Throttle
+		subject  string
+	}{
+		{h.EmailThrottle, email},
+		{h.IPThrottle, c.ClientIP()},
+	} {
+		if limit.throttle == nil {
+			continue
+		}
+		wait, err := limit.throttle.Check(limit.subject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		if wait > 0 {
+			setRetryAfter(c, wait)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many sign-in links requested, try again later"})
+			return false
+		}
+		if _, err := limit.throttle.Fail(limit.subject); err != nil {
+			log.Printf("Failed to count sign-in link request: %v", err)
+		}
+	}
+	return true
+}
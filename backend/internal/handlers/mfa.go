@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+// MFAHandler handles two-factor enrolment for the signed-in user
+type MFAHandler struct {
+	DB     *gorm.DB
+	Issuer string // shown as the account issuer in authenticator apps
+}
+
+// TOTPEnrollResponse carries the new secret to the authenticator app
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFACodeRequest represents a request authorised by a second factor
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFALoginRequest completes a login that returned an MFA challenge
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFAChallengeResponse is returned by Login when a second factor is needed
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// EnrollTOTP starts TOTP enrolment by generating a new secret. The secret
+// does not protect the account until it is confirmed with a valid code.
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var existing models.TOTPCredential
+	err = h.DB.First(&existing, "user_id = ?", userID).Error
+	if err == nil && existing.IsConfirmed() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	credential := models.TOTPCredential{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	if err := h.DB.Save(&credential).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrolment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(h.Issuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP completes enrolment with a code from the authenticator app and
+// returns a fresh set of recovery codes. The codes are only shown once.
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var credential models.TOTPCredential
+	if err := h.DB.First(&credential, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pending two-factor enrolment"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if credential.IsConfirmed() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(credential.Secret, req.Code, time.Now(), credential.LastUsedStep)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&credential).Updates(map[string]interface{}{
+			"confirmed_at":   now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditMFAEnabled, userID, "", nil)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTOTP turns off two-factor authentication. It requires a current
+// TOTP code or an unused recovery code.
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ok, err := verifySecondFactor(h.DB, userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditMFADisabled, userID, "", nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// hasMFA checks if the user has a confirmed second factor
+func (h *AuthHandler) hasMFA(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := h.DB.Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// startMFAChallenge responds to a correct password with a challenge token
+// that must be exchanged at /login/mfa together with a second factor
+func (h *AuthHandler) startMFAChallenge(c *gin.Context, user *models.User) {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create MFA challenge"})
+		return
+	}
+
+	challenge := models.MFAChallenge{
+		UserID:    user.UserID,
+		TokenHash: hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}
+	if err := h.DB.Create(&challenge).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create MFA challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// VerifyMFA exchanges an MFA challenge token and a valid second factor for
+// the same tokens Login returns
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var challenge models.MFAChallenge
+	if err := h.DB.Where("token_hash = ?", auth.HashToken(req.MFAToken)).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	if challenge.UsedAt != nil || challenge.IsExpired() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", challenge.UserID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Wrong codes lock out like wrong passwords, so fresh challenges from
+	// repeated logins do not give unlimited guesses
+	subject := accountSubject(&user)
+	if !h.checkLoginThrottles(c, subject) {
+		return
+	}
+
+	// Claim the attempt before checking the code so parallel requests
+	// cannot make more than maxMFAAttempts guesses
+	result := h.DB.Model(&models.MFAChallenge{}).
+		Where("challenge_id = ? AND attempts < ? AND used_at IS NULL", challenge.ChallengeID, maxMFAAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge"})
+		return
+	}
+
+	ok, err := verifySecondFactor(h.DB, challenge.UserID, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		h.recordLoginFailure(subject, c.ClientIP())
+		recordAudit(h.DB, c, models.AuditLoginFailed, challenge.UserID, "", map[string]string{"reason": "bad_second_factor"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// Consume the challenge so it cannot be exchanged twice
+	result = h.DB.Model(&models.MFAChallenge{}).
+		Where("challenge_id = ? AND used_at IS NULL", challenge.ChallengeID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge"})
+		return
+	}
+	h.recordLoginSuccess(subject)
+
+	// The account may have been disabled since the password was checked
+	if !checkCanSignIn(c, &user) {
+		return
+	}
+
+	user.UpdateLastLogin(h.DB)
+
+	resp, err := h.issueTokens(c, h.DB, &user, uuid.New())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditLogin, user.UserID, "", map[string]string{"method": "password", "mfa": "totp"})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, a recovery code.
+// A matched TOTP step or recovery code is consumed so it cannot be reused.
+func verifySecondFactor(db *gorm.DB, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		var credential models.TOTPCredential
+		err := db.First(&credential, "user_id = ? AND confirmed_at IS NOT NULL", userID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		step, ok := auth.ValidateTOTP(credential.Secret, code, time.Now(), credential.LastUsedStep)
+		if !ok {
+			return false, nil
+		}
+		result := db.Model(&models.TOTPCredential{}).
+			Where("user_id = ? AND last_used_step < ?", userID, step).
+			Update("last_used_step", step)
+		return result.RowsAffected == 1, result.Error
+	}
+
+	if recoveryCode != "" {
+		hash := auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode))
+		result := db.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+			Update("used_at", time.Now())
+		return result.RowsAffected == 1, result.Error
+	}
+
+	return false, nil
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and stores new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	records := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		}
+	}
+	return tx.Create(&records).Error
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+	"github.com/jimsyyap/error_app/backend/pkg/oidc"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie binds a login to the browser that started it. It holds
+// the hash of the state so a state/code pair is useless in another browser.
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler handles sign-in through external OpenID Connect providers
+type OIDCHandler struct {
+	DB        *gorm.DB
+	Auth      *AuthHandler // issues our own tokens once the user is known
+	Providers map[string]*oidc.Provider
+}
+
+// OIDC errors
+var (
+	ErrInvalidOIDCState   = errors.New("invalid or expired login state")
+	ErrUnverifiedIdPEmail = errors.New("identity provider did not return a verified email")
+)
+
+// Login redirects the browser to the provider's authorization endpoint
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	state, err := oidc.NewNonce()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	loginState := models.OIDCLoginState{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Config.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := h.DB.Create(&loginState).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	setStateCookie(c, provider, loginState.StateHash, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, verifier))
+}
+
+// Callback completes the authorization code flow, links or creates the
+// user by verified email and returns the same tokens Login does
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Identity provider returned " + errCode})
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code or state"})
+		return
+	}
+
+	// Only the browser that started the login may finish it
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(auth.HashToken(state))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was started in another browser"})
+		return
+	}
+	setStateCookie(c, provider, "", -1)
+
+	loginState, err := h.consumeState(provider.Config.Name, state)
+	if err != nil {
+		if errors.Is(err, ErrInvalidOIDCState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	tokens, err := provider.Exchange(c.Request.Context(), code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", provider.Config.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to exchange authorization code"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), tokens.IDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC ID token from %s rejected: %v", provider.Config.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+
+	var user models.User
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return h.resolveUser(tx, provider.Config.Name, claims, &user)
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnverifiedIdPEmail) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Identity provider did not return a verified email"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		}
+		return
+	}
+
+	if !checkCanSignIn(c, &user) {
+		return
+	}
+
+	// A second factor still applies to federated logins
+	mfaEnabled, err := h.Auth.hasMFA(user.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if mfaEnabled {
+		h.Auth.startMFAChallenge(c, &user)
+		return
+	}
+
+	user.UpdateLastLogin(h.DB)
+
+	resp, err := h.Auth.issueTokens(c, h.DB, &user, uuid.New())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditLogin, user.UserID, "", map[string]string{"method": "oidc", "provider": provider.Config.Name})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// consumeState loads and deletes the stored login state so it is single-use
+func (h *OIDCHandler) consumeState(provider, state string) (*models.OIDCLoginState, error) {
+	var loginState models.OIDCLoginState
+	hash := auth.HashToken(state)
+	if err := h.DB.Where("state_hash = ? AND provider = ?", hash, provider).First(&loginState).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	result := h.DB.Where("state_hash = ?", hash).Delete(&models.OIDCLoginState{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || loginState.IsExpired() {
+		return nil, ErrInvalidOIDCState
+	}
+	return &loginState, nil
+}
+
+// setStateCookie sets or, with a negative maxAge, clears the state cookie
+// of a provider's login
+func setStateCookie(c *gin.Context, provider *oidc.Provider, value string, maxAge int) {
+	path, secure := "/", false
+	if redirect, err := url.Parse(provider.Config.RedirectURL); err == nil {
+		if redirect.Path != "" {
+			path = redirect.Path
+		}
+		secure = redirect.Scheme == "https"
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, path, "", secure, true)
+}
+
+// resolveUser finds the user linked to the provider subject. Otherwise it
+// links the account with the same verified email, or creates a new one.
+func (h *OIDCHandler) resolveUser(tx *gorm.DB, provider string, claims *oidc.Claims, user *models.User) error {
+	var identity models.UserIdentity
+	err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil {
+		return tx.First(user, "user_id = ?", identity.UserID).Error
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return ErrUnverifiedIdPEmail
+	}
+
+	err = tx.Scopes(models.WithEmail(claims.Email)).First(user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		username, err := availableUsername(tx, claims.Email)
+		if err != nil {
+			return err
+		}
+		// Federated users have no password until they set one via reset
+		*user = models.User{
+			Username:  username,
+			Email:     claims.Email,
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if !user.IsVerified() {
+		if err := user.MarkVerified(tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&models.UserIdentity{
+		UserID:    user.UserID,
+		Provider:  provider,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// availableUsername derives a unique username from the local part of an email
+func availableUsername(tx *gorm.DB, email string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return -1
+		}
+	}, strings.SplitN(email, "@", 2)[0])
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Scopes(models.WithUsername(candidate)).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = base + "_" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("could not find an available username")
+}
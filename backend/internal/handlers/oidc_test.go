@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+	"github.com/jimsyyap/error_app/backend/pkg/oidc"
+	"github.com/jimsyyap/error_app/backend/pkg/oidc/oidctest"
+)
+
+const oidcTestCallback = "http://api.test/oidc/mock/callback"
+
+type oidcTest struct {
+	t      *testing.T
+	idp    *oidctest.Server
+	h      *OIDCHandler
+	router *gin.Engine
+}
+
+func newOIDCTest(t *testing.T, identity oidctest.Identity) *oidcTest {
+	t.Helper()
+
+	db := testDB(t)
+	idp, err := oidctest.NewServer("tennis-app", identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name:        "mock",
+		Issuer:      idp.Issuer(),
+		ClientID:    "tennis-app",
+		RedirectURL: oidcTestCallback,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &OIDCHandler{
+		DB:        db,
+		Auth:      testAuthHandler(t, db),
+		Providers: map[string]*oidc.Provider{"mock": provider},
+	}
+	router := gin.New()
+	router.GET("/oidc/:provider/login", h.Login)
+	router.GET("/oidc/:provider/callback", h.Callback)
+	return &oidcTest{t: t, idp: idp, h: h, router: router}
+}
+
+// start calls Login and follows the redirect to the provider. It returns
+// the callback URL the provider sent the browser back to and the state
+// cookie Login set.
+func (o *oidcTest) start() (string, *http.Cookie) {
+	o.t.Helper()
+
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oidc/mock/login", nil))
+	if w.Code != http.StatusFound {
+		o.t.Fatalf("login returned %d: %s", w.Code, w.Body)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		o.t.Fatalf("state cookie = %+v", cookie)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		o.t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location"), cookie
+}
+
+// callback delivers the provider's redirect to Callback
+func (o *oidcTest) callback(location string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	o.t.Helper()
+
+	u, err := url.Parse(location)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+func (o *oidcTest) identities(userID string) []models.UserIdentity {
+	o.t.Helper()
+
+	var identities []models.UserIdentity
+	if err := o.h.DB.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		o.t.Fatal(err)
+	}
+	return identities
+}
+
+var oidcAlice = oidctest.Identity{
+	Subject:       "alice-subject",
+	Email:         "alice@example.com",
+	EmailVerified: true,
+	Name:          "Alice",
+}
+
+func TestOIDCCreatesUser(t *testing.T) {
+	o := newOIDCTest(t, oidcAlice)
+
+	w := o.callback(o.start())
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+	var resp TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("response = %s", w.Body)
+	}
+
+	var user models.User
+	if err := o.h.DB.Scopes(models.WithEmail(oidcAlice.Email)).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsVerified() || user.PasswordHash != "" {
+		t.Fatalf("user = %+v", user)
+	}
+	if ids := o.identities(user.UserID.String()); len(ids) != 1 || ids[0].Subject != oidcAlice.Subject {
+		t.Fatalf("identities = %+v", ids)
+	}
+
+	// Signing in again reuses the linked identity
+	if w := o.callback(o.start()); w.Code != http.StatusOK {
+		t.Fatalf("second callback returned %d: %s", w.Code, w.Body)
+	}
+	var count int64
+	o.h.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d users, want 1", count)
+	}
+}
+
+func TestOIDCLinksExistingUserByEmail(t *testing.T) {
+	o := newOIDCTest(t, oidcAlice)
+	existing := createTestUser(t, o.h.Auth, "alice", "Alice@Example.com", "correct horse battery")
+
+	if w := o.callback(o.start()); w.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+
+	var count int64
+	o.h.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d users, want 1", count)
+	}
+	if ids := o.identities(existing.UserID.String()); len(ids) != 1 {
+		t.Fatalf("identities = %+v", ids)
+	}
+}
+
+func TestOIDCRejectsUnverifiedEmail(t *testing.T) {
+	identity := oidcAlice
+	identity.EmailVerified = false
+	o := newOIDCTest(t, identity)
+	createTestUser(t, o.h.Auth, "alice", "alice@example.com", "correct horse battery")
+
+	if w := o.callback(o.start()); w.Code != http.StatusForbidden {
+		t.Fatalf("callback returned %d, want 403", w.Code)
+	}
+	var count int64
+	o.h.DB.Model(&models.UserIdentity{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("unverified email was linked")
+	}
+}
+
+func TestOIDCRequiresStateCookie(t *testing.T) {
+	o := newOIDCTest(t, oidcAlice)
+
+	location, _ := o.start()
+	if w := o.callback(location, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback without cookie returned %d, want 400", w.Code)
+	}
+
+	// Another browser's cookie does not match either
+	_, other := o.start()
+	if w := o.callback(location, other); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback with another cookie returned %d, want 400", w.Code)
+	}
+}
+
+func TestOIDCStateIsSingleUse(t *testing.T) {
+	o := newOIDCTest(t, oidcAlice)
+
+	location, cookie := o.start()
+	if w := o.callback(location, cookie); w.Code != http.StatusOK {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+	if w := o.callback(location, cookie); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed callback returned %d, want 400", w.Code)
+	}
+}
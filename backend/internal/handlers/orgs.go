@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// OrgHandler handles organizations, their members and custom error types.
+// Callers who are not members get 404 so organizations cannot be probed.
+type OrgHandler struct {
+	DB *gorm.DB
+}
+
+// OrgRequest represents an organization creation request
+type OrgRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Slug string `json:"slug" binding:"required,min=2,max=50,alphanum"`
+}
+
+// MemberRequest adds a user to an organization
+type MemberRequest struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// OrgResponse is an organization with the caller's role in it
+type OrgResponse struct {
+	models.Organization
+	Role string `json:"role"`
+}
+
+// MemberResponse is a membership with the member's username
+type MemberResponse struct {
+	models.OrgMembership
+	Username string `json:"username"`
+}
+
+// CreateOrg creates an organization owned by the caller
+func (h *OrgHandler) CreateOrg(c *gin.Context) {
+	var req OrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	org := models.Organization{Name: req.Name, Slug: req.Slug, CreatedAt: time.Now()}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrgMembership{
+			OrgID:     org.OrgID,
+			UserID:    userID,
+			Role:      models.OrgRoleOwner,
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug already taken"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, OrgResponse{Organization: org, Role: models.OrgRoleOwner})
+}
+
+// ListOrgs lists the organizations the caller belongs to
+func (h *OrgHandler) ListOrgs(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var memberships []models.OrgMembership
+	if err := h.DB.Preload("Organization").Where("user_id = ?", userID).
+		Order("created_at").Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organizations"})
+		return
+	}
+
+	resp := make([]OrgResponse, len(memberships))
+	for i, m := range memberships {
+		resp[i] = OrgResponse{Organization: m.Organization, Role: m.Role}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetOrg gets one of the caller's organizations
+func (h *OrgHandler) GetOrg(c *gin.Context) {
+	membership, ok := h.requireMember(c, false)
+	if !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := h.DB.First(&org, "org_id = ?", membership.OrgID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, OrgResponse{Organization: org, Role: membership.Role})
+}
+
+// ListMembers lists an organization's members
+func (h *OrgHandler) ListMembers(c *gin.Context) {
+	membership, ok := h.requireMember(c, false)
+	if !ok {
+		return
+	}
+
+	var members []models.OrgMembership
+	if err := h.DB.Preload("User").Where("org_id = ?", membership.OrgID).
+		Order("created_at").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve members"})
+		return
+	}
+
+	resp := make([]MemberResponse, len(members))
+	for i, m := range members {
+		resp[i] = MemberResponse{OrgMembership: m, Username: m.User.Username}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// AddMember adds a user to the organization. Owners only.
+func (h *OrgHandler) AddMember(c *gin.Context) {
+	var req MemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleMember
+	}
+	if !models.IsValidOrgRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	owner, ok := h.requireOwner(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := h.DB.Scopes(models.WithUsername(req.Username)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	member := models.OrgMembership{
+		OrgID:     owner.OrgID,
+		UserID:    user.UserID,
+		Role:      req.Role,
+		CreatedAt: time.Now(),
+	}
+	if err := h.DB.Create(&member).Error; err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, MemberResponse{OrgMembership: member, Username: user.Username})
+}
+
+// SetMemberRole changes a member's role. Owners only.
+func (h *OrgHandler) SetMemberRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidOrgRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	owner, ok := h.requireOwner(c)
+	if !ok {
+		return
+	}
+	member, ok := h.findMember(c, owner.OrgID)
+	if !ok {
+		return
+	}
+
+	if member.Role == models.OrgRoleOwner && req.Role != models.OrgRoleOwner && !h.hasOtherOwner(c, member) {
+		return
+	}
+
+	if err := h.DB.Model(member).Update("role", req.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully"})
+}
+
+// RemoveMember removes a member. Owners can remove anyone; other members
+// can only remove themselves.
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	caller, ok := h.requireMember(c, false)
+	if !ok {
+		return
+	}
+	member, ok := h.findMember(c, caller.OrgID)
+	if !ok {
+		return
+	}
+
+	if caller.Role != models.OrgRoleOwner && member.UserID != caller.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	if member.Role == models.OrgRoleOwner && !h.hasOtherOwner(c, member) {
+		return
+	}
+
+	if err := h.DB.Delete(member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// ListSessions lists sessions current members logged for the organization.
+// Owners and coaches only; ?user_id= narrows it to one member.
+func (h *OrgHandler) ListSessions(c *gin.Context) {
+	membership, ok := h.requireMember(c, true)
+	if !ok {
+		return
+	}
+
+	query := h.DB.Model(&models.MatchSession{}).
+		Joins("JOIN org_memberships ON org_memberships.org_id = match_sessions.org_id AND org_memberships.user_id = match_sessions.user_id").
+		Where("match_sessions.org_id = ?", membership.OrgID)
+	if userParam := c.Query("user_id"); userParam != "" {
+		userID, err := uuid.Parse(userParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		query = query.Where("match_sessions.user_id = ?", userID)
+	}
+
+	var sessions []models.MatchSession
+	if err := query.Order("match_sessions.start_time DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// ListErrorTypes lists the organization's custom error types. Archived
+// types are left out unless ?include_archived=true.
+func (h *OrgHandler) ListErrorTypes(c *gin.Context) {
+	membership, ok := h.requireMember(c, false)
+	if !ok {
+		return
+	}
+
+	var errorTypes []models.ErrorType
+	if err := h.DB.Scopes(archivedErrorTypes(c)).Where("org_id = ?", membership.OrgID).
+		Order("position, error_type_id").Find(&errorTypes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve error types"})
+		return
+	}
+
+	c.JSON(http.StatusOK, errorTypes)
+}
+
+// CreateErrorType adds a custom error type. Owners and coaches only.
+func (h *OrgHandler) CreateErrorType(c *gin.Context) {
+	var req ErrorTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	membership, ok := h.requireMember(c, true)
+	if !ok {
+		return
+	}
+
+	saveErrorType(c, h.DB, &models.ErrorType{OrgID: &membership.OrgID}, &req)
+}
+
+// UpdateErrorType changes a custom error type. Owners and coaches only.
+func (h *OrgHandler) UpdateErrorType(c *gin.Context) {
+	var req ErrorTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	membership, ok := h.requireMember(c, true)
+	if !ok {
+		return
+	}
+	errorType, ok := h.findErrorType(c, membership.OrgID)
+	if !ok {
+		return
+	}
+
+	saveErrorType(c, h.DB, errorType, &req)
+}
+
+// DeleteErrorType archives a custom error type. Errors logged with it stay
+// valid but no new ones can be. Owners and coaches only.
+func (h *OrgHandler) DeleteErrorType(c *gin.Context) {
+	membership, ok := h.requireMember(c, true)
+	if !ok {
+		return
+	}
+	errorType, ok := h.findErrorType(c, membership.OrgID)
+	if !ok {
+		return
+	}
+
+	setErrorTypeArchived(c, h.DB, errorType, true)
+}
+
+// RestoreErrorType brings back an archived custom error type. Owners and
+// coaches only.
+func (h *OrgHandler) RestoreErrorType(c *gin.Context) {
+	membership, ok := h.requireMember(c, true)
+	if !ok {
+		return
+	}
+	errorType, ok := h.findErrorType(c, membership.OrgID)
+	if !ok {
+		return
+	}
+
+	setErrorTypeArchived(c, h.DB, errorType, false)
+}
+
+// requireMember loads the caller's membership in the organization in the
+// URL. With staff set, only owners and coaches are let through.
+func (h *OrgHandler) requireMember(c *gin.Context, staff bool) (*models.OrgMembership, bool) {
+	orgID, err := uuid.Parse(c.Param("org_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return nil, false
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	membership, err := findMembership(h.DB, orgID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+	if staff && !membership.IsStaff() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return nil, false
+	}
+
+	return membership, true
+}
+
+// requireOwner is requireMember for owner-only operations
+func (h *OrgHandler) requireOwner(c *gin.Context) (*models.OrgMembership, bool) {
+	membership, ok := h.requireMember(c, false)
+	if !ok {
+		return nil, false
+	}
+	if membership.Role != models.OrgRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return nil, false
+	}
+	return membership, true
+}
+
+// findMember loads the membership of the user in the URL
+func (h *OrgHandler) findMember(c *gin.Context, orgID uuid.UUID) (*models.OrgMembership, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	member, err := findMembership(h.DB, orgID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return member, true
+}
+
+// hasOtherOwner makes sure an organization keeps at least one owner
+func (h *OrgHandler) hasOtherOwner(c *gin.Context, member *models.OrgMembership) bool {
+	var owners int64
+	if err := h.DB.Model(&models.OrgMembership{}).
+		Where("org_id = ? AND role = ? AND user_id <> ?", member.OrgID, models.OrgRoleOwner, member.UserID).
+		Count(&owners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if owners == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An organization needs at least one owner"})
+		return false
+	}
+	return true
+}
+
+// findErrorType loads the organization's error type in the URL
+func (h *OrgHandler) findErrorType(c *gin.Context, orgID uuid.UUID) (*models.ErrorType, bool) {
+	id, err := strconv.Atoi(c.Param("error_type_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid error type ID"})
+		return nil, false
+	}
+
+	var errorType models.ErrorType
+	if err := h.DB.Where("org_id = ?", orgID).First(&errorType, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Error type not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+
+	return &errorType, true
+}
+
+// findMembership looks up a user's membership in an organization
+func findMembership(db *gorm.DB, orgID, userID uuid.UUID) (*models.OrgMembership, error) {
+	var membership models.OrgMembership
+	if err := db.Where("org_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
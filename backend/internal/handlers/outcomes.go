@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
+)
+
+// OutcomeHandler handles point outcome logging. Point outcomes cover
+// winners, forced and unforced errors, aces and double faults by either
+// side, except the player's unforced errors which are the error logs. In a
+// scored session an outcome also records the point it ended.
+type OutcomeHandler struct {
+	DB *gorm.DB
+}
+
+// OutcomeRequest represents a point outcome creation request
+type OutcomeRequest struct {
+	SessionID uuid.UUID          `json:"session_id" binding:"required"`
+	Kind      models.OutcomeKind `json:"kind" binding:"required"`
+	Shot      models.ShotType    `json:"shot"` // serve if omitted for aces and double faults
+	Player    scoring.Side       `json:"player" binding:"required"`
+	PointContextRequest
+}
+
+// ShotStats counts the points ended by a shot
+type ShotStats struct {
+	Winners        int `json:"winners"` // including aces
+	ForcedErrors   int `json:"forced_errors"`
+	UnforcedErrors int `json:"unforced_errors"` // including double faults
+	Aces           int `json:"aces"`
+	DoubleFaults   int `json:"double_faults"`
+
+	// WinnerRatio is winners per unforced error, absent without unforced
+	// errors
+	WinnerRatio *float64 `json:"winner_to_unforced_ratio,omitempty"`
+}
+
+// SideOutcomes is the outcome summary of one side, in total and by shot
+type SideOutcomes struct {
+	Total  ShotStats                     `json:"total"`
+	ByShot map[models.ShotType]ShotStats `json:"by_shot"`
+}
+
+// OutcomeSummary represents a session's point outcome summary. The player's
+// unforced errors include the error logs, by the shot of their root error
+// type; logs of types that are not a shot, such as Footwork, are only in the
+// total.
+type OutcomeSummary struct {
+	TotalPoints int          `json:"total_points"`
+	Player      SideOutcomes `json:"player"`
+	Opponent    SideOutcomes `json:"opponent"`
+}
+
+// RecordOutcome logs how a point ended
+func (h *OutcomeHandler) RecordOutcome(c *gin.Context) {
+	var req OutcomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.PointContextRequest.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	outcome := models.PointOutcome{
+		SessionID: req.SessionID,
+		Kind:      req.Kind,
+		Shot:      req.Shot,
+		Player:    req.Player,
+		Timestamp: time.Now(),
+	}
+	if outcome.Shot == "" && (outcome.Kind == models.OutcomeAce || outcome.Kind == models.OutcomeDoubleFault) {
+		outcome.Shot = models.ShotServe
+	}
+	if err := outcome.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if outcome.Kind == models.OutcomeUnforcedError && outcome.Player == scoring.SidePlayer {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Log the player's unforced errors as errors"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Verify session exists and belongs to the user
+	var session models.MatchSession
+	if err := h.DB.Where("session_id = ? AND user_id = ?", req.SessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if !session.IsActive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot log outcomes to a completed session"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if outcome.PointContext, err = req.PointContextRequest.resolve(tx, &session); err != nil {
+			return err
+		}
+		if session.IsScored() {
+			_, point, err := addPoint(tx, &session, outcome.PointWinner())
+			if err != nil {
+				return err
+			}
+			outcome.PointID = &point.PointID
+		}
+		return tx.Create(&outcome).Error
+	})
+	if err != nil {
+		respondScoringError(c, err, "Failed to log outcome")
+		return
+	}
+
+	c.JSON(http.StatusCreated, outcome)
+}
+
+// UndoLastOutcome removes the last point outcome in a session together
+// with the point it recorded, which must be the session's last point
+func (h *OutcomeHandler) UndoLastOutcome(c *gin.Context) {
+	var req struct {
+		SessionID uuid.UUID `json:"session_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Verify session exists and belongs to the user
+	var session models.MatchSession
+	if err := h.DB.Where("session_id = ? AND user_id = ?", req.SessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	var last models.PointOutcome
+	if err := h.DB.Where("session_id = ?", req.SessionID).Order("timestamp DESC").First(&last).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No outcomes to undo"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if last.PointID != nil {
+			state, err := scoreForUpdate(tx, &session)
+			if err != nil {
+				return err
+			}
+			result := tx.Where("point_id = ? AND sequence = ?", *last.PointID, state.Points).Delete(&models.Point{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrNotLastPoint
+			}
+			if state, err = models.ReplayScore(tx, &session); err != nil {
+				return err
+			}
+			if err := tx.Model(&session).Update("score", state.String()).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&last).Error
+	})
+	if err != nil {
+		respondScoringError(c, err, "Failed to undo outcome")
+		return
+	}
+	recordAudit(h.DB, c, models.AuditOutcomeUndone, userID, last.OutcomeID.String(), map[string]string{
+		"session_id": req.SessionID.String(),
+		"kind":       string(last.Kind),
+		"shot":       string(last.Shot),
+		"player":     string(last.Player),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Last outcome undone successfully"})
+}
+
+// ListOutcomes lists the point outcomes of one of the user's sessions in
+// the order they were logged
+func (h *OutcomeHandler) ListOutcomes(c *gin.Context) {
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var outcomes []models.PointOutcome
+	if err := h.DB.Where("session_id = ?", session.SessionID).Order("timestamp").Find(&outcomes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve outcomes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, outcomes)
+}
+
+// GetOutcomeSummary gets the point outcome summary of one of the user's
+// sessions
+func (h *OutcomeHandler) GetOutcomeSummary(c *gin.Context) {
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+
+	summary, err := buildOutcomeSummary(h.DB, session.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// buildOutcomeSummary counts a session's point outcomes and error logs for
+// each side, in total and by shot
+func buildOutcomeSummary(db *gorm.DB, sessionID uuid.UUID) (*OutcomeSummary, error) {
+	var rows []struct {
+		Player scoring.Side
+		Shot   models.ShotType
+		Kind   models.OutcomeKind
+		Count  int
+	}
+	err := db.Model(&models.PointOutcome{}).
+		Select("player, shot, kind, COUNT(*) AS count").
+		Where("session_id = ?", sessionID).
+		Group("player, shot, kind").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &OutcomeSummary{
+		Player:   SideOutcomes{ByShot: make(map[models.ShotType]ShotStats)},
+		Opponent: SideOutcomes{ByShot: make(map[models.ShotType]ShotStats)},
+	}
+	for _, row := range rows {
+		side := &summary.Player
+		if row.Player == scoring.SideOpponent {
+			side = &summary.Opponent
+		}
+		shot := side.ByShot[row.Shot]
+		shot.add(row.Kind, row.Count)
+		side.ByShot[row.Shot] = shot
+		side.Total.add(row.Kind, row.Count)
+		summary.TotalPoints += row.Count
+	}
+
+	var errorRows []struct {
+		ErrorTypeID int
+		Count       int
+	}
+	err = db.Model(&models.ErrorLog{}).
+		Select("error_type_id, COUNT(*) AS count").
+		Where("session_id = ?", sessionID).
+		Group("error_type_id").
+		Scan(&errorRows).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(errorRows))
+	for _, row := range errorRows {
+		ids = append(ids, row.ErrorTypeID)
+	}
+	types, err := loadErrorTypeTree(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range errorRows {
+		if root, ok := rootErrorType(types, row.ErrorTypeID); ok {
+			if shot, ok := models.ShotForErrorType(root.Name); ok {
+				stats := summary.Player.ByShot[shot]
+				stats.add(models.OutcomeUnforcedError, row.Count)
+				summary.Player.ByShot[shot] = stats
+			}
+		}
+		summary.Player.Total.add(models.OutcomeUnforcedError, row.Count)
+		summary.TotalPoints += row.Count
+	}
+
+	for _, side := range []*SideOutcomes{&summary.Player, &summary.Opponent} {
+		side.Total.setRatio()
+		for shot, stats := range side.ByShot {
+			stats.setRatio()
+			side.ByShot[shot] = stats
+		}
+	}
+	return summary, nil
+}
+
+// add counts n outcomes of a kind
+func (s *ShotStats) add(kind models.OutcomeKind, n int) {
+	switch kind {
+	case models.OutcomeWinner:
+		s.Winners += n
+	case models.OutcomeAce:
+		s.Winners += n
+		s.Aces += n
+	case models.OutcomeForcedError:
+		s.ForcedErrors += n
+	case models.OutcomeUnforcedError:
+		s.UnforcedErrors += n
+	case models.OutcomeDoubleFault:
+		s.UnforcedErrors += n
+		s.DoubleFaults += n
+	}
+}
+
+func (s *ShotStats) setRatio() {
+	if s.UnforcedErrors == 0 {
+		return
+	}
+	ratio := float64(s.Winners) / float64(s.UnforcedErrors)
+	s.WinnerRatio = &ratio
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/mailer"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// PasswordHandler handles password recovery requests
+type PasswordHandler struct {
+	DB          *gorm.DB
+	Mailer      mailer.Mailer
+	BaseURL     string // frontend URL the reset link points to
+	ResetExpiry int    // reset token expiration in minutes
+	ResendWait  int    // minimum seconds between reset emails requested for an account
+	Passwords   *auth.PasswordHasher
+}
+
+// ForgotPasswordRequest represents a password reset request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents a password reset confirmation
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ChangePasswordRequest represents a password change by a signed-in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// ErrInvalidResetToken is returned for unknown, used or expired reset tokens
+var ErrInvalidResetToken = errors.New("invalid reset token")
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email belongs to an account, and whether the link was
+// held back because one was sent less than ResendWait seconds ago or could
+// not be sent.
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accepted := gin.H{"message": "If the email is registered, a reset link has been sent"}
+
+	var user models.User
+	if err := h.DB.Scopes(models.WithEmail(req.Email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusAccepted, accepted)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	var last models.PasswordResetToken
+	err := h.DB.Where("user_id = ?", user.UserID).Order("created_at DESC").First(&last).Error
+	if err == nil && time.Since(last.CreatedAt) < time.Duration(h.ResendWait)*time.Second {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := h.SendResetLink(c.Request.Context(), &user); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// SendResetLink creates a reset token for the user and emails the link.
+// Only the most recent link stays valid.
+func (h *PasswordHandler) SendResetLink(ctx context.Context, user *models.User) error {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.InvalidatePasswordResets(tx, user.UserID); err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.UserID,
+			TokenHash: hash,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Duration(h.ResetExpiry) * time.Minute),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Tennis Error Tracker password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes.\n\n%s/reset-password?token=%s\n\nIf you did not ask for a reset you can ignore this email.\n",
+			user.Username, h.ResetExpiry, h.BaseURL, url.QueryEscape(token)),
+	}
+	return h.Mailer.Send(ctx, msg)
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := h.Passwords.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var reset models.PasswordResetToken
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", auth.HashToken(req.Token)).First(&reset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+
+		if reset.IsExpired() {
+			return ErrInvalidResetToken
+		}
+		ok, err := reset.Consume(tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidResetToken
+		}
+
+		if err := tx.Model(&models.User{}).Where("user_id = ?", reset.UserID).
+			Updates(map[string]interface{}{
+				"password_hash":           hashedPassword,
+				"password_reset_required": false,
+			}).Error; err != nil {
+			return err
+		}
+		return models.RevokeUserRefreshTokens(tx, reset.UserID)
+	})
+
+	switch {
+	case err == nil:
+		recordAudit(h.DB, c, models.AuditPasswordReset, reset.UserID, "", nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+	case errors.Is(err, ErrInvalidResetToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+	}
+}
+
+// ChangePassword sets a new password after checking the current one. All
+// refresh tokens are revoked and the caller gets a fresh pair, so every
+// other signed-in device has to log in again.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Accounts created through an identity provider have no password yet
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set a password with a password reset first"})
+		return
+	}
+	// The current password is not trusted once an admin has forced a reset
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, use the link sent by email"})
+		return
+	}
+	if !h.verifyCurrentPassword(c, &user, req.CurrentPassword, "Invalid current password") {
+		return
+	}
+
+	hashedPassword, err := h.Passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var resp *TokenResponse
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
+		if err := models.RevokeUserRefreshTokens(tx, user.UserID); err != nil {
+			return err
+		}
+		resp, err = h.issueTokens(c, tx, &user, uuid.New())
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditPasswordChanged, user.UserID, "", nil)
+
+	c.JSON(http.StatusOK, resp)
+}
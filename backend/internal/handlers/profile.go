@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// ProfileHandler handles the current user's player profile
+type ProfileHandler struct {
+	DB *gorm.DB
+}
+
+// MeResponse is the current user with their player profile
+type MeResponse struct {
+	models.User
+	Profile models.PlayerProfile `json:"profile"`
+}
+
+// GetMe gets the current user and their profile
+func (h *ProfileHandler) GetMe(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	profile, err := loadProfile(h.DB, user.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MeResponse{User: user, Profile: *profile})
+}
+
+// UpdateProfile applies a partial update to the current user's profile.
+// Fields left out are unchanged and fields set to null are cleared.
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	profile, err := loadProfile(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Decoding over the stored profile only touches the fields in the body
+	if err := c.ShouldBindJSON(profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := profile.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile.UserID = userID
+	profile.UpdatedAt = time.Now()
+	if err := h.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// loadProfile returns the user's profile, or an empty one if none is stored
+func loadProfile(db *gorm.DB, userID uuid.UUID) (*models.PlayerProfile, error) {
+	profile := models.PlayerProfile{UserID: userID}
+	err := db.First(&profile, "user_id = ?", userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &profile, nil
+}
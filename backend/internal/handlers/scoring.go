@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
+)
+
+// ScoringRequest starts keeping the score of a session
+type ScoringRequest struct {
+	Format      *scoring.Format `json:"format"` // best of three tiebreak sets if omitted
+	FirstServer scoring.Side    `json:"first_server" binding:"required"`
+}
+
+// PointRequest records the winner of the next point
+type PointRequest struct {
+	Winner scoring.Side `json:"winner" binding:"required"`
+}
+
+// ScoreResponse is the derived score of a session together with its
+// canonical score string
+type ScoreResponse struct {
+	*scoring.State
+	Score string `json:"score"`
+}
+
+// SessionResponse is a session with its derived score if it is scored
+type SessionResponse struct {
+	models.MatchSession
+	ScoreState *ScoreResponse `json:"score_state,omitempty"`
+}
+
+// Scoring-related errors
+var (
+	ErrNotScored     = errors.New("session is not being scored")
+	ErrAlreadyScored = errors.New("session already has points")
+	ErrNoPoints      = errors.New("no points recorded")
+	ErrPointConflict = errors.New("another point was recorded at the same time")
+	ErrSessionEnded  = errors.New("session has ended")
+	ErrNotLastPoint  = errors.New("later points have been recorded")
+)
+
+// GetSession gets one of the user's sessions with its derived score
+func (h *SessionHandler) GetSession(c *gin.Context) {
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+
+	state, err := models.ReplayScore(h.DB, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute score"})
+		return
+	}
+
+	resp := SessionResponse{MatchSession: *session}
+	if state != nil {
+		resp.ScoreState = &ScoreResponse{State: state, Score: state.String()}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// StartScoring sets the format and first server of an active session. It
+// can be changed until the first point is recorded.
+func (h *SessionHandler) StartScoring(c *gin.Context) {
+	var req ScoringRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := scoring.DefaultFormat
+	if req.Format != nil {
+		format = *req.Format
+	}
+	state, err := scoring.NewMatch(format, req.FirstServer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+	if !session.IsActive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session already ended"})
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var points int64
+		if err := tx.Model(&models.Point{}).Where("session_id = ?", session.SessionID).Count(&points).Error; err != nil {
+			return err
+		}
+		if points > 0 {
+			return ErrAlreadyScored
+		}
+		first, score := string(req.FirstServer), state.String()
+		session.ScoringFormat, session.FirstServer, session.Score = &format, &first, &score
+		return tx.Model(session).Select("scoring_format", "first_server", "score").Updates(session).Error
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, ScoreResponse{State: state, Score: state.String()})
+	case errors.Is(err, ErrAlreadyScored):
+		c.JSON(http.StatusConflict, gin.H{"error": "Points have already been recorded"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start scoring"})
+	}
+}
+
+// RecordPoint records the winner of the next point of the user's active
+// scored session and returns the new score
+func (h *SessionHandler) RecordPoint(c *gin.Context) {
+	var req PointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Winner.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": scoring.ErrInvalidSide.Error()})
+		return
+	}
+
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var state *scoring.State
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		state, _, err = addPoint(tx, session, req.Winner)
+		return err
+	})
+	if err != nil {
+		respondScoringError(c, err, "Failed to record point")
+		return
+	}
+
+	c.JSON(http.StatusCreated, ScoreResponse{State: state, Score: state.String()})
+}
+
+// UndoLastPoint removes the most recent point of the user's active scored
+// session and returns the score before it
+func (h *SessionHandler) UndoLastPoint(c *gin.Context) {
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+
+	var state *scoring.State
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := scoreForUpdate(tx, session)
+		if err != nil {
+			return err
+		}
+		if current.Points == 0 {
+			return ErrNoPoints
+		}
+
+		result := tx.Where("session_id = ? AND sequence = ?", session.SessionID, current.Points).Delete(&models.Point{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPointConflict
+		}
+
+		if state, err = models.ReplayScore(tx, session); err != nil {
+			return err
+		}
+		return tx.Model(session).Update("score", state.String()).Error
+	})
+	if err != nil {
+		respondScoringError(c, err, "Failed to undo point")
+		return
+	}
+
+	c.JSON(http.StatusOK, ScoreResponse{State: state, Score: state.String()})
+}
+
+// addPoint records the next point of an active scored session in tx and
+// updates its score
+func addPoint(tx *gorm.DB, session *models.MatchSession, winner scoring.Side) (*scoring.State, *models.Point, error) {
+	state, err := scoreForUpdate(tx, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := state.AddPoint(winner); err != nil {
+		return nil, nil, err
+	}
+
+	point := models.Point{
+		SessionID: session.SessionID,
+		Sequence:  state.Points,
+		Winner:    winner,
+		Timestamp: time.Now(),
+	}
+	if err := tx.Create(&point).Error; err != nil {
+		if isUniqueViolation(err) {
+			return nil, nil, ErrPointConflict
+		}
+		return nil, nil, err
+	}
+	if err := tx.Model(session).Update("score", state.String()).Error; err != nil {
+		return nil, nil, err
+	}
+	return state, &point, nil
+}
+
+// scoreForUpdate replays the score of an active scored session before it is
+// changed
+func scoreForUpdate(tx *gorm.DB, session *models.MatchSession) (*scoring.State, error) {
+	if !session.IsActive() {
+		return nil, ErrSessionEnded
+	}
+	if !session.IsScored() {
+		return nil, ErrNotScored
+	}
+	return models.ReplayScore(tx, session)
+}
+
+// respondScoringError maps an error from recording or undoing a point to a
+// response
+func respondScoringError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrSessionEnded):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session already ended"})
+	case errors.Is(err, ErrNotScored):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Session is not being scored"})
+	case errors.Is(err, ErrNoPoints):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No points to undo"})
+	case errors.Is(err, scoring.ErrMatchOver):
+		c.JSON(http.StatusConflict, gin.H{"error": "Match is already over"})
+	case errors.Is(err, ErrNotLastPoint):
+		c.JSON(http.StatusConflict, gin.H{"error": "Undo the later points first"})
+	case errors.Is(err, ErrPointConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "The score changed, try again"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// ownSession loads the session named by the session_id parameter if it
+// belongs to the user. It writes the error response and reports false
+// otherwise.
+func ownSession(c *gin.Context, db *gorm.DB) (*models.MatchSession, bool) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return nil, false
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var session models.MatchSession
+	if err := db.Where("session_id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return nil, false
+	}
+	return &session, true
+}
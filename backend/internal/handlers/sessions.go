@@ -3,6 +3,8 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +12,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/jimsyyap/error_app/backend/pkg/models"
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
 )
 
 // SessionHandler handles session-related operations
@@ -19,15 +22,74 @@ type SessionHandler struct {
 
 // SessionRequest represents a session creation request
 type SessionRequest struct {
-	OpponentName *string `json:"opponent_name"`
-	Location     *string `json:"location"`
-	Notes        *string `json:"notes"`
+	OpponentName *string    `json:"opponent_name"`
+	Location     *string    `json:"location"`
+	Notes        *string    `json:"notes"`
+	OrgID        *uuid.UUID `json:"org_id"` // log the session for an organization
 }
 
 // SessionSummary represents a session's error summary
 type SessionSummary struct {
-	TotalErrors  int            `json:"total_errors"`
-	ErrorsByType map[string]int `json:"errors_by_type"`
+	TotalErrors      int              `json:"total_errors"`
+	ErrorsByType     []ErrorTypeCount `json:"errors_by_type"`
+	ErrorsByPressure PressureSummary  `json:"errors_by_pressure"`
+}
+
+// ErrorTypeCount counts a session's errors of one error type. Ancestors of
+// the logged types are listed too, so a parent such as Serve rolls up its
+// subtypes in Total even if no error was logged with it directly.
+type ErrorTypeCount struct {
+	ErrorTypeID int    `json:"error_type_id"`
+	Name        string `json:"name"`
+	ParentID    *int   `json:"parent_id,omitempty"`
+	Count       int    `json:"count"` // logged with exactly this type
+	Total       int    `json:"total"` // including subtypes
+}
+
+// PressureSummary counts errors by the situation they were made in. An
+// error on a point that is both a break point and a set point counts under
+// both.
+type PressureSummary struct {
+	BreakPointServing   int `json:"break_point_serving"`   // facing a break point on the player's serve
+	BreakPointReturning int `json:"break_point_returning"` // holding a break point on the opponent's serve
+	SetPoint            int `json:"set_point"`             // either side could win the set
+	NoPressure          int `json:"no_pressure"`
+	Unknown             int `json:"unknown"` // logged without point context
+}
+
+// ErrorPivot counts a session's errors by two dimensions, the error type or
+// an error attribute. Errors without the attribute count as unspecified.
+// Error types are keyed by ID and described in ErrorTypes, since custom and
+// global types may share a name.
+type ErrorPivot struct {
+	Rows         string                    `json:"rows"`
+	Columns      string                    `json:"columns"`
+	Cells        map[string]map[string]int `json:"cells"` // row, then column
+	RowTotals    map[string]int            `json:"row_totals"`
+	ColumnTotals map[string]int            `json:"column_totals"`
+	Total        int                       `json:"total"`
+	ErrorTypes   map[string]PivotErrorType `json:"error_types,omitempty"`
+}
+
+// PivotErrorType names an error type key of a pivot
+type PivotErrorType struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id,omitempty"`
+}
+
+// PivotByErrorType is the pivot dimension of the error type; the others are
+// the error attributes
+const PivotByErrorType = "error_type"
+
+// PivotUnspecified is the key of errors without the attribute
+const PivotUnspecified = "unspecified"
+
+// pivotExpressions maps each pivot dimension to its column
+var pivotExpressions = map[string]string{
+	PivotByErrorType:          "CAST(error_logs.error_type_id AS TEXT)",
+	models.AttributeMiss:      "error_logs.miss",
+	models.AttributeDirection: "error_logs.direction",
+	models.AttributeSpin:      "error_logs.spin",
 }
 
 // StartSession starts a new match session
@@ -43,6 +105,18 @@ func (h *SessionHandler) StartSession(c *gin.Context) {
 		return
 	}
 
+	// Only members can log sessions for an organization
+	if req.OrgID != nil {
+		if _, err := findMembership(h.DB, *req.OrgID, userID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+	}
+
 	// Check if user already has an active session
 	var activeSession models.MatchSession
 	result := h.DB.Where("user_id = ? AND end_time IS NULL", userID).First(&activeSession)
@@ -60,6 +134,7 @@ func (h *SessionHandler) StartSession(c *gin.Context) {
 	// Create new session
 	session := models.MatchSession{
 		UserID:       userID,
+		OrgID:        req.OrgID,
 		StartTime:    time.Now(),
 		OpponentName: req.OpponentName,
 		Location:     req.Location,
@@ -110,11 +185,13 @@ func (h *SessionHandler) EndSession(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
 		return
 	}
+	recordAudit(h.DB, c, models.AuditSessionEnded, userID, session.SessionID.String(), nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Session ended successfully"})
 }
 
-// GetSessions gets all user's sessions
+// GetSessions gets all user's sessions, optionally only those logged for
+// one organization (?org_id=)
 func (h *SessionHandler) GetSessions(c *gin.Context) {
 	userID, err := GetUserID(c)
 	if err != nil {
@@ -122,8 +199,18 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 		return
 	}
 
+	query := h.DB.Where("user_id = ?", userID)
+	if orgParam := c.Query("org_id"); orgParam != "" {
+		orgID, err := uuid.Parse(orgParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+			return
+		}
+		query = query.Where("org_id = ?", orgID)
+	}
+
 	var sessions []models.MatchSession
-	if err := h.DB.Where("user_id = ?", userID).Order("start_time DESC").Find(&sessions).Error; err != nil {
+	if err := query.Order("start_time DESC").Find(&sessions).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
 		return
 	}
@@ -142,4 +229,239 @@ func (h *SessionHandler) GetActiveSession(c *gin.Context) {
 	var session models.MatchSession
 	result := h.DB.Where("user_id = ? AND end_time IS NULL", userID).First(&session)
 	if result.Error != nil {
-		if errors.Is(result.
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.Status(http.StatusNoContent)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// GetSummary gets the error summary of one of the user's sessions
+func (h *SessionHandler) GetSummary(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Verify session exists and belongs to the user
+	var session models.MatchSession
+	if err := h.DB.Where("session_id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	summary, err := buildSummary(h.DB, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetErrorPivot counts the errors of one of the user's sessions by the
+// dimensions in ?rows= and ?columns=, by default error type against miss
+func (h *SessionHandler) GetErrorPivot(c *gin.Context) {
+	rows, columns, ok := pivotDimensions(c)
+	if !ok {
+		return
+	}
+
+	session, ok := ownSession(c, h.DB)
+	if !ok {
+		return
+	}
+
+	pivot, err := buildErrorPivot(h.DB, session.SessionID, rows, columns)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pivot)
+}
+
+// pivotDimensions reads the rows and columns of a pivot from the query. It
+// writes the error response and reports false if they are invalid.
+func pivotDimensions(c *gin.Context) (string, string, bool) {
+	rows := c.DefaultQuery("rows", PivotByErrorType)
+	columns := c.DefaultQuery("columns", models.AttributeMiss)
+	_, rowsOK := pivotExpressions[rows]
+	_, columnsOK := pivotExpressions[columns]
+	if !rowsOK || !columnsOK || rows == columns {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rows and columns must be two of error_type, miss, direction and spin"})
+		return "", "", false
+	}
+	return rows, columns, true
+}
+
+// buildErrorPivot counts a session's errors by two pivot dimensions
+func buildErrorPivot(db *gorm.DB, sessionID uuid.UUID, rows, columns string) (*ErrorPivot, error) {
+	var counts []struct {
+		RowKey    string
+		ColumnKey string
+		Count     int
+	}
+	err := db.Model(&models.ErrorLog{}).
+		Select("COALESCE("+pivotExpressions[rows]+", ?) AS row_key, COALESCE("+pivotExpressions[columns]+", ?) AS column_key, COUNT(*) AS count",
+			PivotUnspecified, PivotUnspecified).
+		Where("error_logs.session_id = ?", sessionID).
+		Group("row_key, column_key").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pivot := &ErrorPivot{
+		Rows:         rows,
+		Columns:      columns,
+		Cells:        make(map[string]map[string]int),
+		RowTotals:    make(map[string]int),
+		ColumnTotals: make(map[string]int),
+	}
+	for _, count := range counts {
+		if pivot.Cells[count.RowKey] == nil {
+			pivot.Cells[count.RowKey] = make(map[string]int)
+		}
+		pivot.Cells[count.RowKey][count.ColumnKey] = count.Count
+		pivot.RowTotals[count.RowKey] += count.Count
+		pivot.ColumnTotals[count.ColumnKey] += count.Count
+		pivot.Total += count.Count
+	}
+
+	if rows != PivotByErrorType && columns != PivotByErrorType {
+		return pivot, nil
+	}
+	var types []models.ErrorType
+	err = db.Where("error_type_id IN (?)", db.Model(&models.ErrorLog{}).
+		Select("error_type_id").Where("session_id = ?", sessionID)).
+		Find(&types).Error
+	if err != nil {
+		return nil, err
+	}
+	pivot.ErrorTypes = make(map[string]PivotErrorType, len(types))
+	for _, errorType := range types {
+		pivot.ErrorTypes[strconv.Itoa(errorType.ErrorTypeID)] = PivotErrorType{Name: errorType.Name, ParentID: errorType.ParentID}
+	}
+	return pivot, nil
+}
+
+// buildSummary counts a session's errors in total and by error type
+func buildSummary(db *gorm.DB, sessionID uuid.UUID) (*SessionSummary, error) {
+	var rows []struct {
+		ErrorTypeID int
+		Count       int
+	}
+	err := db.Model(&models.ErrorLog{}).
+		Select("error_type_id, COUNT(*) AS count").
+		Where("session_id = ?", sessionID).
+		Group("error_type_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &SessionSummary{}
+	counts := make(map[int]*ErrorTypeCount, len(rows))
+	ids := make([]int, 0, len(rows))
+	for _, row := range rows {
+		counts[row.ErrorTypeID] = &ErrorTypeCount{ErrorTypeID: row.ErrorTypeID, Count: row.Count}
+		ids = append(ids, row.ErrorTypeID)
+		summary.TotalErrors += row.Count
+	}
+
+	types, err := loadErrorTypeTree(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for id, depth := row.ErrorTypeID, 0; depth <= models.MaxErrorTypeDepth; depth++ {
+			errorType, ok := types[id]
+			if !ok {
+				break
+			}
+			count := counts[id]
+			if count == nil {
+				count = &ErrorTypeCount{ErrorTypeID: id}
+				counts[id] = count
+			}
+			count.Total += row.Count
+			if errorType.ParentID == nil {
+				break
+			}
+			id = *errorType.ParentID
+		}
+	}
+
+	summary.ErrorsByType = make([]ErrorTypeCount, 0, len(counts))
+	for id, count := range counts {
+		count.Name, count.ParentID = types[id].Name, types[id].ParentID
+		summary.ErrorsByType = append(summary.ErrorsByType, *count)
+	}
+	sort.Slice(summary.ErrorsByType, func(i, j int) bool {
+		return summary.ErrorsByType[i].ErrorTypeID < summary.ErrorsByType[j].ErrorTypeID
+	})
+
+	err = db.Model(&models.ErrorLog{}).
+		Select(`COUNT(*) FILTER (WHERE break_point AND server = ?) AS break_point_serving,
+			COUNT(*) FILTER (WHERE break_point AND server = ?) AS break_point_returning,
+			COUNT(*) FILTER (WHERE set_point) AS set_point,
+			COUNT(*) FILTER (WHERE NOT break_point AND NOT set_point) AS no_pressure,
+			COUNT(*) FILTER (WHERE break_point IS NULL OR set_point IS NULL) AS unknown`,
+			string(scoring.SidePlayer), string(scoring.SideOpponent)).
+		Where("session_id = ?", sessionID).
+		Scan(&summary.ErrorsByPressure).Error
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// loadErrorTypeTree loads the error types ids and their ancestors a level at
+// a time
+func loadErrorTypeTree(db *gorm.DB, ids []int) (map[int]models.ErrorType, error) {
+	types := make(map[int]models.ErrorType)
+	for depth := 0; len(ids) > 0 && depth <= models.MaxErrorTypeDepth; depth++ {
+		var level []models.ErrorType
+		if err := db.Where("error_type_id IN ?", ids).Find(&level).Error; err != nil {
+			return nil, err
+		}
+		ids = ids[:0]
+		for _, errorType := range level {
+			types[errorType.ErrorTypeID] = errorType
+			if parent := errorType.ParentID; parent != nil {
+				if _, ok := types[*parent]; !ok {
+					ids = append(ids, *parent)
+				}
+			}
+		}
+	}
+	return types, nil
+}
+
+// rootErrorType returns the top ancestor of the error type id
+func rootErrorType(types map[int]models.ErrorType, id int) (models.ErrorType, bool) {
+	errorType, ok := types[id]
+	for depth := 0; ok && errorType.ParentID != nil && depth < models.MaxErrorTypeDepth; depth++ {
+		var parent models.ErrorType
+		if parent, ok = types[*errorType.ParentID]; ok {
+			errorType = parent
+		}
+	}
+	return errorType, ok
+}
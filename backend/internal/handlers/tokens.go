@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// RefreshRequest represents a token refresh or logout request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh-related errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// issueTokens signs a short-lived access token for the user and stores a new
+// refresh token in the given family. The family is also the device session,
+// which is created or updated from the request.
+func (h *AuthHandler) issueTokens(c *gin.Context, tx *gorm.DB, user *models.User, familyID uuid.UUID) (*TokenResponse, error) {
+	if err := models.RecordDeviceSession(tx, &models.DeviceSession{
+		DeviceID:  familyID,
+		UserID:    user.UserID,
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		IP:        c.ClientIP(),
+	}); err != nil {
+		return nil, err
+	}
+
+	tokenString, err := h.Keys.Sign(h.accessClaims(user, familyID))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    user.UserID,
+		FamilyID:  familyID,
+		TokenHash: refreshHash,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Duration(h.RefreshExpiry) * time.Hour),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.AccessExpiry) * 60,
+	}, nil
+}
+
+// accessClaims builds the claims of an access token for the user on the
+// given device session
+func (h *AuthHandler) accessClaims(user *models.User, deviceID uuid.UUID) jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id":        user.UserID.String(),
+		"sid":            deviceID.String(),
+		"role":           user.Role,
+		"email_verified": user.IsVerified(),
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Duration(h.AccessExpiry) * time.Minute).Unix(),
+	}
+}
+
+// issueImpersonationToken signs an access token that lets an admin act as
+// the user for support. The token names the admin in its impersonator
+// claim and gets its own device session, so the user can see and revoke
+// it. No refresh token is issued; the access is over when the token expires.
+func (h *AuthHandler) issueImpersonationToken(c *gin.Context, user *models.User, adminID uuid.UUID) (*TokenResponse, error) {
+	deviceID := uuid.New()
+	if err := models.RecordDeviceSession(h.DB, &models.DeviceSession{
+		DeviceID:       deviceID,
+		UserID:         user.UserID,
+		UserAgent:      truncate(c.Request.UserAgent(), 255),
+		IP:             c.ClientIP(),
+		ImpersonatorID: &adminID,
+	}); err != nil {
+		return nil, err
+	}
+
+	claims := h.accessClaims(user, deviceID)
+	claims["impersonator"] = adminID.String()
+	tokenString, err := h.Keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:     tokenString,
+		ExpiresIn: int64(h.AccessExpiry) * 60,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// Replaying a token that has already been rotated revokes its whole family.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resp *TokenResponse
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		if err := tx.Where("token_hash = ?", auth.HashToken(req.RefreshToken)).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if stored.RevokedAt != nil || stored.IsExpired() {
+			return ErrInvalidRefreshToken
+		}
+
+		ok, err := stored.MarkUsed(tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrRefreshTokenReused
+		}
+
+		var user models.User
+		if err := tx.First(&user, "user_id = ?", stored.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if user.IsPendingDeletion() || user.IsDisabled() {
+			return ErrInvalidRefreshToken
+		}
+
+		resp, err = h.issueTokens(c, tx, &user, stored.FamilyID)
+		return err
+	})
+
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, resp)
+	case errors.Is(err, ErrRefreshTokenReused):
+		// The rotation above was rolled back, so revoke outside the transaction
+		var stored models.RefreshToken
+		if h.DB.Where("token_hash = ?", auth.HashToken(req.RefreshToken)).First(&stored).Error == nil {
+			models.RevokeRefreshFamily(h.DB, stored.FamilyID)
+			recordAudit(h.DB, c, models.AuditRefreshReuse, stored.UserID, stored.FamilyID.String(), nil)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used"})
+	case errors.Is(err, ErrInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+	}
+}
+
+// Logout revokes the refresh token family the given token belongs to
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := h.DB.Where("token_hash = ?", auth.HashToken(req.RefreshToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if err := models.RevokeRefreshFamily(h.DB, stored.FamilyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditLogout, stored.UserID, stored.FamilyID.String(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// JWKS publishes the public keys used to verify access tokens
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Keys.JWKS())
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/mailer"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// VerificationHandler handles email address verification
+type VerificationHandler struct {
+	DB         *gorm.DB
+	Mailer     mailer.Mailer
+	BaseURL    string // frontend URL the verification link points to
+	Expiry     int    // verification token expiration in hours
+	ResendWait int    // minimum seconds between verification emails
+}
+
+// VerifyEmailRequest represents an email verification confirmation
+type VerifyEmailRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+// ResendVerificationRequest represents a request for a new verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Verification errors
+var (
+	ErrInvalidVerifyToken    = errors.New("invalid verification token")
+	ErrVerificationThrottled = errors.New("verification email sent too recently")
+)
+
+// SendVerification creates a verification token for the user and emails it.
+// Only the most recent link stays valid. If a token was sent less than
+// ResendWait seconds ago it returns ErrVerificationThrottled.
+func (h *VerificationHandler) SendVerification(ctx context.Context, user *models.User) error {
+	var last models.EmailVerificationToken
+	err := h.DB.Where("user_id = ?", user.UserID).Order("created_at DESC").First(&last).Error
+	if err == nil {
+		if time.Since(last.CreatedAt) < time.Duration(h.ResendWait)*time.Second {
+			return ErrVerificationThrottled
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.InvalidateEmailVerifications(tx, user.UserID); err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerificationToken{
+			UserID:    user.UserID,
+			TokenHash: hash,
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Duration(h.Expiry) * time.Hour),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Tennis Error Tracker email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s/verify-email?token=%s\n",
+			user.Username, h.Expiry, h.BaseURL, url.QueryEscape(token)),
+	}
+	return h.Mailer.Send(ctx, msg)
+}
+
+// VerifyEmail confirms an email address. The token may be passed as a
+// query parameter (GET) or in the JSON body (POST).
+func (h *VerificationHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var record models.EmailVerificationToken
+		if err := tx.Where("token_hash = ?", auth.HashToken(req.Token)).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidVerifyToken
+			}
+			return err
+		}
+
+		if record.IsExpired() {
+			return ErrInvalidVerifyToken
+		}
+		ok, err := record.Consume(tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidVerifyToken
+		}
+
+		var user models.User
+		if err := tx.First(&user, "user_id = ?", record.UserID).Error; err != nil {
+			return err
+		}
+		if user.IsVerified() {
+			return nil
+		}
+		return user.MarkVerified(tx)
+	})
+
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+	case errors.Is(err, ErrInvalidVerifyToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+	}
+}
+
+// ResendVerification sends a new verification email unless one was sent
+// less than ResendWait seconds ago. The response does not reveal whether
+// the email belongs to an account or whether an email was sent.
+func (h *VerificationHandler) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accepted := gin.H{"message": "If the email needs verifying, a new link has been sent"}
+
+	var user models.User
+	if err := h.DB.Scopes(models.WithEmail(req.Email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusAccepted, accepted)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if user.IsVerified() {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	// Answering 429 or 500 here would reveal that the account exists
+	if err := h.SendVerification(c.Request.Context(), &user); err != nil && !errors.Is(err, ErrVerificationThrottled) {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
+}
@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+const webAuthnChallengeTTL = 5 * time.Minute
+
+// WebAuthnHandler handles passkey registration for signed-in users and
+// passkey sign-in as an alternative to a password
+type WebAuthnHandler struct {
+	DB       *gorm.DB
+	WebAuthn *webauthn.WebAuthn
+	Auth     *AuthHandler // issues the tokens and applies the IP login throttle
+}
+
+// PasskeyBeginResponse carries the options for navigator.credentials and
+// the handle that ties the authenticator's response to this ceremony
+type PasskeyBeginResponse struct {
+	Session string      `json:"session"`
+	Options interface{} `json:"options"`
+}
+
+// PasskeyFinishRequest carries the authenticator's response to a ceremony
+type PasskeyFinishRequest struct {
+	Session    string          `json:"session" binding:"required"`
+	Name       string          `json:"name" binding:"max=100"` // registration only
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// WebAuthn-related errors
+var (
+	ErrInvalidWebAuthnSession = errors.New("invalid or expired passkey session")
+	ErrUnknownPasskey         = errors.New("unknown passkey")
+	ErrPasskeyCloned          = errors.New("passkey sign count did not increase")
+)
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the user ID, which lets discoverable logins find the account.
+type webAuthnUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte          { return u.user.UserID[:] }
+func (u *webAuthnUser) WebAuthnName() string        { return u.user.Username }
+func (u *webAuthnUser) WebAuthnDisplayName() string { return u.user.Username }
+func (u *webAuthnUser) WebAuthnIcon() string        { return "" }
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for j, t := range c.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+		creds[i] = webauthn.Credential{
+			ID:              c.RawID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: uint32(c.SignCount),
+			},
+		}
+	}
+	return creds
+}
+
+// credential finds the stored passkey with the given raw credential ID
+func (u *webAuthnUser) credential(rawID []byte) *models.WebAuthnCredential {
+	for i := range u.credentials {
+		if bytes.Equal(u.credentials[i].RawID, rawID) {
+			return &u.credentials[i]
+		}
+	}
+	return nil
+}
+
+// loadWebAuthnUser loads a user together with their passkeys
+func loadWebAuthnUser(db *gorm.DB, userID uuid.UUID) (*webAuthnUser, error) {
+	var user models.User
+	if err := db.First(&user, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	var creds []models.WebAuthnCredential
+	if err := db.Where("user_id = ?", userID).Find(&creds).Error; err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: &user, credentials: creds}, nil
+}
+
+// BeginRegistration starts adding a passkey to the signed-in user's account.
+// Passkeys must be discoverable and verify the user, so they can sign in
+// without a username or a second factor.
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	user, err := loadWebAuthnUser(h.DB, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Do not register the same authenticator twice
+	var exclude []protocol.CredentialDescriptor
+	for _, cred := range user.WebAuthnCredentials() {
+		exclude = append(exclude, cred.Descriptor())
+	}
+
+	options, session, err := h.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclude),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		}))
+	if err != nil {
+		log.Printf("Failed to begin passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	handle, err := h.storeChallenge(&userID, models.WebAuthnCeremonyRegistration, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PasskeyBeginResponse{Session: handle, Options: options})
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores
+// the new passkey
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	var req PasskeyFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	session, err := h.consumeChallenge(req.Session, models.WebAuthnCeremonyRegistration, &userID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidWebAuthnSession) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired passkey session"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	user, err := loadWebAuthnUser(h.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey response"})
+		return
+	}
+	cred, err := h.WebAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey could not be verified"})
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+
+	passkey := models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		RawID:           cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       int64(cred.Authenticator.SignCount),
+		Transports:      transports,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+	if err := h.DB.Create(&passkey).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Passkey is already registered"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		}
+		return
+	}
+	recordAudit(h.DB, c, models.AuditPasskeyAdded, userID, passkey.CredentialID.String(), map[string]string{"name": passkey.Name})
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// ListPasskeys lists the signed-in user's passkeys
+func (h *WebAuthnHandler) ListPasskeys(c *gin.Context) {
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var passkeys []models.WebAuthnCredential
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// DeletePasskey removes one of the signed-in user's passkeys
+func (h *WebAuthnHandler) DeletePasskey(c *gin.Context) {
+	credentialID, err := uuid.Parse(c.Param("credential_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	userID, err := GetUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var passkey models.WebAuthnCredential
+	if err := h.DB.Where("credential_id = ? AND user_id = ?", credentialID, userID).First(&passkey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if err := h.DB.Delete(&passkey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditPasskeyRemoved, userID, passkey.CredentialID.String(), map[string]string{"name": passkey.Name})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted successfully"})
+}
+
+// BeginLogin starts a passkey sign-in. No username is taken: the
+// authenticator offers its discoverable credentials and the response names
+// the account, so the endpoint reveals nothing about which accounts exist.
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	if !h.checkIPThrottle(c) {
+		return
+	}
+
+	options, session, err := h.WebAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		log.Printf("Failed to begin passkey login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey sign-in"})
+		return
+	}
+
+	handle, err := h.storeChallenge(nil, models.WebAuthnCeremonyLogin, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey sign-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PasskeyBeginResponse{Session: handle, Options: options})
+}
+
+// FinishLogin verifies a passkey assertion and returns the same tokens as
+// Login. A passkey with user verification already combines possession and
+// a PIN or biometric, so no TOTP challenge follows. An assertion whose sign
+// count did not increase points to a cloned authenticator and is refused.
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req PasskeyFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkIPThrottle(c) {
+		return
+	}
+
+	session, err := h.consumeChallenge(req.Session, models.WebAuthnCeremonyLogin, nil)
+	if err != nil {
+		if errors.Is(err, ErrInvalidWebAuthnSession) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired passkey session"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey response"})
+		return
+	}
+
+	// The user handle in the response names the account
+	var user *webAuthnUser
+	cred, err := h.WebAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, ErrUnknownPasskey
+		}
+		user, err = loadWebAuthnUser(h.DB, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user.credential(rawID) == nil {
+			return nil, ErrUnknownPasskey
+		}
+		return user, nil
+	}, *session, parsed)
+	if err == nil && cred.Authenticator.CloneWarning {
+		err = ErrPasskeyCloned
+	}
+
+	var passkey *models.WebAuthnCredential
+	if err == nil {
+		passkey = user.credential(cred.ID)
+		// Another login with the same count may have got there first
+		ok, uerr := passkey.RecordUse(h.DB, cred.Authenticator.SignCount, cred.Flags.BackupState)
+		if uerr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !ok {
+			err = ErrPasskeyCloned
+		}
+	}
+
+	if err != nil {
+		h.recordIPFailure(c.ClientIP())
+		if user != nil {
+			reason := "bad_assertion"
+			if errors.Is(err, ErrPasskeyCloned) {
+				reason = "sign_count"
+			}
+			recordAudit(h.DB, c, models.AuditLoginFailed, user.user.UserID, "", map[string]string{"method": "webauthn", "reason": reason})
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey could not be verified"})
+		return
+	}
+
+	if !checkCanSignIn(c, user.user) {
+		return
+	}
+
+	if h.Auth.RequireVerified && !user.user.IsVerified() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	user.user.UpdateLastLogin(h.DB)
+
+	resp, err := h.Auth.issueTokens(c, h.DB, user.user, uuid.New())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	recordAudit(h.DB, c, models.AuditLogin, user.user.UserID, passkey.CredentialID.String(), map[string]string{"method": "webauthn"})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkIPThrottle responds with 429 and reports false if the client IP is
+// locked out by failed logins of any kind
+func (h *WebAuthnHandler) checkIPThrottle(c *gin.Context) bool {
+	if h.Auth.IPThrottle == nil {
+		return true
+	}
+	wait, err := h.Auth.IPThrottle.Check(c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if wait > 0 {
+		setRetryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
+
+// recordIPFailure counts a failed passkey sign-in against the client IP.
+// There is no username to count it against.
+func (h *WebAuthnHandler) recordIPFailure(ip string) {
+	if h.Auth.IPThrottle != nil {
+		if _, err := h.Auth.IPThrottle.Fail(ip); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+	}
+}
+
+// storeChallenge saves the ceremony's session data and returns the handle
+// the client sends back with the authenticator's response
+func (h *WebAuthnHandler) storeChallenge(userID *uuid.UUID, ceremony string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	handle, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.WebAuthnChallenge{
+		HandleHash:  hash,
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: data,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(webAuthnChallengeTTL),
+	}
+	if err := h.DB.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return handle, nil
+}
+
+// consumeChallenge loads and deletes a stored ceremony so it is single-use.
+// The ceremony and the user it was started for must match.
+func (h *WebAuthnHandler) consumeChallenge(handle, ceremony string, userID *uuid.UUID) (*webauthn.SessionData, error) {
+	var challenge models.WebAuthnChallenge
+	hash := auth.HashToken(handle)
+	if err := h.DB.Where("handle_hash = ?", hash).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidWebAuthnSession
+		}
+		return nil, err
+	}
+
+	result := h.DB.Where("handle_hash = ?", hash).Delete(&models.WebAuthnChallenge{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || challenge.IsExpired() || challenge.Ceremony != ceremony {
+		return nil, ErrInvalidWebAuthnSession
+	}
+	if (userID == nil) != (challenge.UserID == nil) || (userID != nil && *userID != *challenge.UserID) {
+		return nil, ErrInvalidWebAuthnSession
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(challenge.SessionData, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
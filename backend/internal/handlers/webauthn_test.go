@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+const (
+	passkeyRPID   = "localhost"
+	passkeyOrigin = "http://localhost:3000"
+)
+
+var b64url = base64.RawURLEncoding
+
+// softAuthenticator is a software passkey holding one P-256 credential. It
+// produces the same "none" attestations and assertions a platform
+// authenticator would, with user presence and verification.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, id: id}
+}
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(passkeyRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func clientDataJSON(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": passkeyOrigin})
+	return data
+}
+
+// create answers a registration challenge
+func (a *softAuthenticator) create(t *testing.T, challenge string) json.RawMessage {
+	t.Helper()
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, publicKey...)
+
+	object, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(flagUserPresent|flagUserVerified|flagAttested, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64url.EncodeToString(clientDataJSON("webauthn.create", challenge)),
+		"attestationObject": b64url.EncodeToString(object),
+	})
+}
+
+// get answers a login challenge, counting the signature
+func (a *softAuthenticator) get(t *testing.T, challenge string, userHandle []byte) json.RawMessage {
+	t.Helper()
+
+	a.signCount++
+	authData := a.authData(flagUserPresent|flagUserVerified, nil)
+	clientData := clientDataJSON("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64url.EncodeToString(clientData),
+		"authenticatorData": b64url.EncodeToString(authData),
+		"signature":         b64url.EncodeToString(signature),
+		"userHandle":        b64url.EncodeToString(userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) json.RawMessage {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       b64url.EncodeToString(a.id),
+		"rawId":    b64url.EncodeToString(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type passkeyTest struct {
+	t      *testing.T
+	h      *WebAuthnHandler
+	router *gin.Engine
+	user   *models.User
+}
+
+func newPasskeyTest(t *testing.T) *passkeyTest {
+	t.Helper()
+
+	db := testDB(t)
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          passkeyRPID,
+		RPDisplayName: "Tennis Error Tracker",
+		RPOrigins:     []string{passkeyOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &WebAuthnHandler{DB: db, WebAuthn: w, Auth: testAuthHandler(t, db)}
+	user := createTestUser(t, h.Auth, "alice", "alice@example.com", "correct horse battery")
+
+	router := gin.New()
+	router.POST("/login/passkey/begin", h.BeginLogin)
+	router.POST("/login/passkey/finish", h.FinishLogin)
+	signedIn := router.Group("/account", func(c *gin.Context) { c.Set("user_id", user.UserID) })
+	signedIn.POST("/passkeys/begin", h.BeginRegistration)
+	signedIn.POST("/passkeys/finish", h.FinishRegistration)
+	return &passkeyTest{t: t, h: h, router: router, user: user}
+}
+
+func (p *passkeyTest) post(path string, body interface{}) *httptest.ResponseRecorder {
+	p.t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	p.router.ServeHTTP(w, req)
+	return w
+}
+
+// begin starts a ceremony and returns its session handle and challenge
+func (p *passkeyTest) begin(path string) (string, string) {
+	p.t.Helper()
+
+	w := p.post(path, nil)
+	if w.Code != http.StatusOK {
+		p.t.Fatalf("%s returned %d: %s", path, w.Code, w.Body)
+	}
+	var resp struct {
+		Session string
+		Options struct {
+			PublicKey struct {
+				Challenge string
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		p.t.Fatal(err)
+	}
+	return resp.Session, resp.Options.PublicKey.Challenge
+}
+
+func (p *passkeyTest) register(a *softAuthenticator) {
+	p.t.Helper()
+
+	session, challenge := p.begin("/account/passkeys/begin")
+	w := p.post("/account/passkeys/finish", PasskeyFinishRequest{
+		Session:    session,
+		Name:       "Laptop",
+		Credential: a.create(p.t, challenge),
+	})
+	if w.Code != http.StatusCreated {
+		p.t.Fatalf("registration returned %d: %s", w.Code, w.Body)
+	}
+}
+
+func (p *passkeyTest) login(a *softAuthenticator) *httptest.ResponseRecorder {
+	p.t.Helper()
+
+	session, challenge := p.begin("/login/passkey/begin")
+	return p.post("/login/passkey/finish", PasskeyFinishRequest{
+		Session:    session,
+		Credential: a.get(p.t, challenge, p.user.UserID[:]),
+	})
+}
+
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	p := newPasskeyTest(t)
+	a := newSoftAuthenticator(t)
+	p.register(a)
+
+	w := p.login(a)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body)
+	}
+	var resp TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("response = %s", w.Body)
+	}
+
+	var passkey models.WebAuthnCredential
+	if err := p.h.DB.Where("user_id = ?", p.user.UserID).First(&passkey).Error; err != nil {
+		t.Fatal(err)
+	}
+	if passkey.SignCount != 1 || passkey.LastUsedAt == nil {
+		t.Fatalf("passkey = %+v", passkey)
+	}
+
+	// A passkey of no registered credential is refused
+	if w := p.login(newSoftAuthenticator(t)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown passkey returned %d, want 401", w.Code)
+	}
+}
+
+func TestPasskeyChallengeIsSingleUse(t *testing.T) {
+	p := newPasskeyTest(t)
+	a := newSoftAuthenticator(t)
+	p.register(a)
+
+	session, challenge := p.begin("/login/passkey/begin")
+	assertion := a.get(t, challenge, p.user.UserID[:])
+	if w := p.post("/login/passkey/finish", PasskeyFinishRequest{Session: session, Credential: assertion}); w.Code != http.StatusOK {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body)
+	}
+
+	// The same session cannot be finished again, even with a fresh signature
+	fresh := a.get(t, challenge, p.user.UserID[:])
+	if w := p.post("/login/passkey/finish", PasskeyFinishRequest{Session: session, Credential: fresh}); w.Code != http.StatusBadRequest {
+		t.Fatalf("reused session returned %d, want 400", w.Code)
+	}
+
+	// Nor can the old assertion answer a new challenge
+	session, _ = p.begin("/login/passkey/begin")
+	if w := p.post("/login/passkey/finish", PasskeyFinishRequest{Session: session, Credential: assertion}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed assertion returned %d, want 401", w.Code)
+	}
+}
+
+func TestPasskeySignCountRegression(t *testing.T) {
+	p := newPasskeyTest(t)
+	a := newSoftAuthenticator(t)
+	p.register(a)
+
+	for i := 0; i < 3; i++ {
+		if w := p.login(a); w.Code != http.StatusOK {
+			t.Fatalf("login %d returned %d: %s", i+1, w.Code, w.Body)
+		}
+	}
+
+	// A clone of the authenticator taken after the first login
+	clone := *a
+	clone.signCount = 1
+	if w := p.login(&clone); w.Code != http.StatusUnauthorized {
+		t.Fatalf("cloned passkey returned %d, want 401", w.Code)
+	}
+
+	var passkey models.WebAuthnCredential
+	if err := p.h.DB.Where("user_id = ?", p.user.UserID).First(&passkey).Error; err != nil {
+		t.Fatal(err)
+	}
+	if passkey.SignCount != 3 {
+		t.Fatalf("sign count = %d, want 3", passkey.SignCount)
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -9,10 +10,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/auth"
+	"github.com/jimsyyap/error_app/backend/pkg/models"
 )
 
-// JWTMiddleware creates a middleware for JWT authentication
-func JWTMiddleware(secret string) gin.HandlerFunc {
+// deviceSeenInterval limits how often a device's last use is written
+const deviceSeenInterval = time.Minute
+
+// JWTMiddleware creates a middleware for JWT authentication. Personal API
+// tokens are accepted as well and are looked up in db.
+func JWTMiddleware(keys *auth.Keyring, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -30,14 +39,16 @@ func JWTMiddleware(secret string) gin.HandlerFunc {
 			return
 		}
 
+		// Personal API tokens are opaque and looked up in the database
+		if strings.HasPrefix(parts[1], auth.APITokenPrefix) {
+			authenticateAPIToken(c, db, parts[1])
+			return
+		}
+
 		// Parse and validate the token
-		token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
-			// Validate the algorithm
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return []byte(secret), nil
-		})
+		// The keyring looks up the key by kid and checks the algorithm
+		token, err := jwt.Parse(parts[1], keys.Keyfunc,
+			jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -62,7 +73,22 @@ func JWTMiddleware(secret string) gin.HandlerFunc {
 				return
 			}
 			
+			// Reject tokens of devices that have been signed out
+			deviceID, ok := checkDeviceSession(c, db, claims, userID)
+			if !ok {
+				return
+			}
+
 			c.Set("user_id", userID)
+			c.Set("device_id", deviceID)
+			if impersonator, ok := claims["impersonator"].(string); ok {
+				if adminID, err := uuid.Parse(impersonator); err == nil {
+					c.Set("impersonator_id", adminID)
+				}
+			}
+			c.Set("email_verified", claims["email_verified"] == true)
+			c.Set("role", claims["role"])
+			c.Set("auth_method", AuthMethodJWT)
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -71,3 +97,94 @@ func JWTMiddleware(secret string) gin.HandlerFunc {
 		}
 	}
 }
+
+// RequireVerifiedEmail rejects requests from users who have not confirmed
+// their email address. It must run after JWTMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if verified, _ := c.Get("email_verified"); verified != true {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole limits a route to users holding one of the given roles. It
+// must run after JWTMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, r := range roles {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
+// DenyImpersonation limits a route to the account owner, so an admin
+// signed in as the user for support cannot change their credentials. It
+// must run after JWTMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonator_id"); impersonating {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used while impersonating"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkDeviceSession looks up the device session named by the sid claim and
+// records that it was seen. It aborts the request and reports false if the
+// session is missing or revoked, or the account has been disabled.
+func checkDeviceSession(c *gin.Context, db *gorm.DB, claims jwt.MapClaims, userID uuid.UUID) (uuid.UUID, bool) {
+	sid, _ := claims["sid"].(string)
+	deviceID, err := uuid.Parse(sid)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return uuid.Nil, false
+	}
+
+	var device models.DeviceSession
+	err = db.Joins("User").
+		Where("device_sessions.device_id = ? AND device_sessions.user_id = ?", deviceID, userID).
+		First(&device).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		c.Abort()
+		return uuid.Nil, false
+	}
+	if device.IsRevoked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		c.Abort()
+		return uuid.Nil, false
+	}
+	if device.User.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		c.Abort()
+		return uuid.Nil, false
+	}
+
+	// Only write once a minute per device
+	if time.Since(device.LastSeenAt) > deviceSeenInterval {
+		err = db.Model(&models.DeviceSession{}).Where("device_id = ?", device.DeviceID).
+			Update("last_seen_at", time.Now()).Error
+		if err != nil {
+			log.Printf("Failed to update device last seen: %v", err)
+		}
+	}
+
+	return deviceID, true
+}
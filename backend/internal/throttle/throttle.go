@@ -0,0 +1,107 @@
+package throttle
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/models"
+)
+
+// Throttle locks out a key after repeated failures, doubling the lockout
+// for every failure past the threshold. State lives in Postgres so every
+// backend instance sees the same counters.
+type Throttle struct {
+	DB        *gorm.DB
+	Scope     string        // recorded on lockouts, e.g. "account" or "ip"
+	Threshold int           // failures before the first lockout
+	Base      time.Duration // first lockout duration
+	Max       time.Duration // longest lockout duration
+	Window    time.Duration // failures older than this are forgotten
+}
+
+// Check returns how long the key remains locked, or zero if it is not
+func (t *Throttle) Check(subject string) (time.Duration, error) {
+	var state models.LoginThrottle
+	err := t.DB.Where("throttle_key = ?", t.key(subject)).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if state.LockedUntil == nil {
+		return 0, nil
+	}
+	if wait := time.Until(*state.LockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt and returns the lockout it triggered, if any
+func (t *Throttle) Fail(subject string) (time.Duration, error) {
+	now := time.Now()
+
+	// Count the failure atomically, starting over if the last one was
+	// outside the window
+	var failures int
+	err := t.DB.Raw(`
+		INSERT INTO login_throttles (throttle_key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1
+				ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`,
+		t.key(subject), now, now.Add(-t.Window)).Scan(&failures).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if failures < t.Threshold {
+		return 0, nil
+	}
+
+	lockFor := t.lockoutDuration(failures)
+	lockedUntil := now.Add(lockFor)
+	err = t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.LoginThrottle{}).Where("throttle_key = ?", t.key(subject)).
+			Update("locked_until", lockedUntil).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LoginLockout{
+			Scope:       t.Scope,
+			Subject:     subject,
+			Failures:    failures,
+			LockedAt:    now,
+			LockedUntil: lockedUntil,
+		}).Error
+	})
+	return lockFor, err
+}
+
+// Reset clears the failure count after a successful attempt
+func (t *Throttle) Reset(subject string) error {
+	return t.DB.Where("throttle_key = ?", t.key(subject)).Delete(&models.LoginThrottle{}).Error
+}
+
+// lockoutDuration doubles the base duration for each failure past the
+// threshold, capped at Max
+func (t *Throttle) lockoutDuration(failures int) time.Duration {
+	exp := failures - t.Threshold
+	if exp > 30 {
+		return t.Max
+	}
+	d := time.Duration(float64(t.Base) * math.Pow(2, float64(exp)))
+	if d > t.Max {
+		return t.Max
+	}
+	return d
+}
+
+func (t *Throttle) key(subject string) string {
+	return t.Scope + ":" + subject
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Keyring errors
+var (
+	ErrNoSigningKey      = errors.New("no active signing key")
+	ErrUnknownKeyID      = errors.New("unknown key id")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match key")
+)
+
+// Key is a single JWT signing or verification key identified by its kid
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PublicKey  crypto.PublicKey
+	PrivateKey crypto.Signer // nil for verify-only keys loaded from a public key
+	ModTime    time.Time
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.PrivateKey != nil
+}
+
+// Keyring holds the keys used to sign and verify access tokens.
+// One key is active for signing; every key in the ring is accepted for
+// verification so tokens signed before a rotation remain valid until they
+// expire.
+//
+// A key directory is rotated without a restart, sending SIGHUP to every
+// instance after each step:
+//
+//  1. Add the new private key. The reload publishes it and accepts its
+//     tokens but keeps signing with the old key.
+//  2. Once every instance has reloaded, reload again to switch signing to
+//     the new key, the newest private key that was already in the ring.
+//     With JWT_ACTIVE_KID set, change it and restart instead.
+//  3. Replace the old private key with its public key so its tokens still
+//     verify, and delete that file once they have expired.
+//
+// A key is never used for signing on the reload that adds it, so no
+// instance signs a token the others cannot verify yet.
+type Keyring struct {
+	mu       sync.RWMutex
+	keys     map[string]*Key
+	activeID string
+	dir      string
+	pinnedID string
+}
+
+// NewKeyring creates an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*Key)}
+}
+
+// LoadKeyring loads every *.pem file in dir into a keyring. The file name
+// without extension is used as the kid. Private keys (PKCS#8 or PKCS#1) can
+// sign; public keys (PKIX) are kept for verification only. If activeID is
+// empty the most recently modified private key becomes the active key; on
+// later reloads only a key that was in the ring before is activated.
+func LoadKeyring(dir, activeID string) (*Keyring, error) {
+	kr := NewKeyring()
+	kr.dir = dir
+	kr.pinnedID = activeID
+	if err := kr.Reload(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// NewEphemeralKeyring creates a keyring with a freshly generated Ed25519 key.
+// It is meant for local development; tokens do not survive a restart.
+func NewEphemeralKeyring() (*Keyring, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newKey(fmt.Sprintf("dev-%d", time.Now().Unix()), priv.Public(), priv)
+	if err != nil {
+		return nil, err
+	}
+	kr := NewKeyring()
+	kr.Add(key)
+	return kr, kr.SetActive(key.ID)
+}
+
+// Reload re-reads the key directory, picking up new keys and dropping
+// removed ones. New keys are published but not activated until the next
+// reload. It is a no-op for keyrings not backed by a directory.
+func (kr *Keyring) Reload() error {
+	if kr.dir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(kr.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key, len(paths))
+	for _, path := range paths {
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", path, err)
+		}
+		keys[key.ID] = key
+	}
+
+	activeID := kr.pinnedID
+	if activeID == "" {
+		kr.mu.RLock()
+		activeID = newestSigningKey(keys, kr.keys)
+		kr.mu.RUnlock()
+	}
+	if active, ok := keys[activeID]; !ok || !active.CanSign() {
+		return fmt.Errorf("%w: %q", ErrNoSigningKey, activeID)
+	}
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.activeID = activeID
+	kr.mu.Unlock()
+	return nil
+}
+
+// Add adds or replaces a key in the ring without making it active
+func (kr *Keyring) Add(key *Key) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.keys[key.ID] = key
+}
+
+// SetActive makes the key with the given kid the signing key
+func (kr *Keyring) SetActive(kid string) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	key, ok := kr.keys[kid]
+	if !ok {
+		return ErrUnknownKeyID
+	}
+	if !key.CanSign() {
+		return ErrNoSigningKey
+	}
+	kr.activeID = kid
+	return nil
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	kr.mu.RLock()
+	key, ok := kr.keys[kr.activeID]
+	kr.mu.RUnlock()
+	if !ok || !key.CanSign() {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token from its kid
+// header. It can be passed directly to jwt.Parse.
+func (kr *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKeyID
+	}
+
+	kr.mu.RLock()
+	key, ok := kr.keys[kid]
+	kr.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.PublicKey, nil
+}
+
+// JWK is a single JSON Web Key as published in the JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key in the ring
+func (kr *Keyring) JWKS() JWKS {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(kr.keys))}
+	for _, key := range kr.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// loadKeyFile parses a PEM file into a Key
+func loadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var key *Key
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		key, err = newKey(kid, signer.Public(), signer)
+		if err != nil {
+			return nil, err
+		}
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, err = newKey(kid, &parsed.PublicKey, parsed)
+		if err != nil {
+			return nil, err
+		}
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, err = newKey(kid, parsed, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: PEM type %q", ErrUnsupportedKey, block.Type)
+	}
+
+	key.ModTime = info.ModTime()
+	return key, nil
+}
+
+// newKey picks the signing method matching the key type
+func newKey(kid string, pub crypto.PublicKey, priv crypto.Signer) (*Key, error) {
+	key := &Key{ID: kid, PublicKey: pub, PrivateKey: priv}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return key, nil
+}
+
+// newestSigningKey returns the kid of the most recently modified private key
+// that is also in the previous ring. Any key qualifies when there was none.
+func newestSigningKey(keys, previous map[string]*Key) string {
+	var newest *Key
+	for _, key := range keys {
+		if !key.CanSign() {
+			continue
+		}
+		if _, ok := previous[key.ID]; len(previous) > 0 && !ok {
+			continue
+		}
+		if newest == nil || key.ModTime.After(newest.ModTime) ||
+			(key.ModTime.Equal(newest.ModTime) && key.ID > newest.ID) {
+			newest = key
+		}
+	}
+	if newest == nil {
+		return ""
+	}
+	return newest.ID
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keeps the tests fast
+var testArgon2Params = Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2Params}
+
+	hash, err := h.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("hash = %q", hash)
+	}
+	again, err := h.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Fatal("two hashes share a salt")
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		ok          bool
+		needsRehash bool
+	}{
+		{name: "correct password", password: "correct horse battery", ok: true},
+		{name: "wrong password", password: "correct horse staple"},
+		{name: "empty password", password: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := h.Verify(tt.password, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || needsRehash != tt.needsRehash {
+				t.Errorf("Verify() = %v, %v, want %v, %v", ok, needsRehash, tt.ok, tt.needsRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	argon := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2Params}
+	argonHash, err := argon.Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := (&PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}).Hash("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withParams := func(change func(*Argon2Params)) *PasswordHasher {
+		p := testArgon2Params
+		change(&p)
+		return &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: p}
+	}
+
+	tests := []struct {
+		name        string
+		hasher      *PasswordHasher
+		hash        string
+		needsRehash bool
+	}{
+		{name: "argon2id with the current parameters", hasher: argon, hash: argonHash},
+		{name: "argon2id memory raised", hasher: withParams(func(p *Argon2Params) { p.Memory = 128 }), hash: argonHash, needsRehash: true},
+		{name: "argon2id time raised", hasher: withParams(func(p *Argon2Params) { p.Time = 2 }), hash: argonHash, needsRehash: true},
+		{name: "argon2id threads raised", hasher: withParams(func(p *Argon2Params) { p.Threads = 2 }), hash: argonHash, needsRehash: true},
+		{name: "argon2id key length changed", hasher: withParams(func(p *Argon2Params) { p.KeyLen = 64 }), hash: argonHash, needsRehash: true},
+		{name: "argon2id salt length changed", hasher: withParams(func(p *Argon2Params) { p.SaltLen = 32 }), hash: argonHash},
+		{name: "argon2id after switching to bcrypt", hasher: &PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}, hash: argonHash, needsRehash: true},
+		{name: "bcrypt with the current cost", hasher: &PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}, hash: bcryptHash},
+		{name: "bcrypt cost raised", hasher: &PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1}, hash: bcryptHash, needsRehash: true},
+		{name: "bcrypt after switching to argon2id", hasher: argon, hash: bcryptHash, needsRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := tt.hasher.Verify("correct horse battery", tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatal("correct password was refused")
+			}
+			if needsRehash != tt.needsRehash {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, tt.needsRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	h := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2Params}
+
+	// A hash stored before the switch to argon2id
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, needsRehash, err := h.Verify("correct horse battery", string(legacy)); err != nil || !ok || !needsRehash {
+		t.Errorf("correct password: Verify() = %v, %v, %v, want true, true, nil", ok, needsRehash, err)
+	}
+	if ok, needsRehash, err := h.Verify("correct horse staple", string(legacy)); err != nil || ok || needsRehash {
+		t.Errorf("wrong password: Verify() = %v, %v, %v, want false, false, nil", ok, needsRehash, err)
+	}
+}
+
+func TestVerifyMalformedHashes(t *testing.T) {
+	h := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2Params}
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{name: "empty hash"},
+		{name: "unknown algorithm", hash: "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5", wantErr: true},
+		{name: "argon2id missing the key", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA", wantErr: true},
+		{name: "argon2id of another version", hash: "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _, err := h.Verify("correct horse battery", tt.hash)
+			if ok || (err != nil) != tt.wantErr {
+				t.Errorf("Verify() = %v, %v, want false, error %v", ok, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+// Scopes that can be granted to personal API tokens. Interactive logins
+// (JWT access tokens) are not limited by scope.
+const (
+	ScopeErrorsRead    = "errors:read"
+	ScopeErrorsWrite   = "errors:write"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+)
+
+// APITokenPrefix marks personal API tokens so they can be told apart from
+// JWTs in the Authorization header
+const APITokenPrefix = "tet_"
+
+// KnownScopes lists every scope a token may be granted
+var KnownScopes = []string{
+	ScopeErrorsRead,
+	ScopeErrorsWrite,
+	ScopeSessionsRead,
+	ScopeSessionsWrite,
+}
+
+// IsKnownScope checks if scope is one of KnownScopes
+func IsKnownScope(scope string) bool {
+	for _, s := range KnownScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
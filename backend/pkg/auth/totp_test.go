@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the RFC 6238 test vectors,
+// "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The RFC gives eight digits; six-digit codes are the last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC 6238 vector at 1111111109 is the step before the one at
+	// 1111111111
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       time.Time
+		lastStep int64
+		want     int64
+		ok       bool
+	}{
+		{name: "current step", code: "050471", at: now, want: current, ok: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "050471", at: now, want: current, ok: true},
+		{name: "surrounding spaces", code: " 050471 ", at: now, want: current, ok: true},
+		{name: "one step behind", code: "050471", at: now.Add(totpPeriod * time.Second), want: current, ok: true},
+		{name: "one step ahead", code: "050471", at: now.Add(-totpPeriod * time.Second), want: current, ok: true},
+		{name: "two steps behind", code: "050471", at: now.Add(2 * totpPeriod * time.Second)},
+		{name: "two steps ahead", code: "050471", at: now.Add(-2 * totpPeriod * time.Second)},
+		{name: "replayed step", code: "050471", at: now, lastStep: current},
+		{name: "step before the last one", code: "081804", at: now, lastStep: current - 1},
+		{name: "step after the last one", code: "050471", at: now, lastStep: current - 1, want: current, ok: true},
+		{name: "wrong code", code: "123456", at: now},
+		{name: "eight digits", code: "14050471", at: now},
+		{name: "invalid secret", secret: "not base32!", code: "050471", at: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			if secret == "" {
+				secret = rfc6238Secret
+			}
+			step, ok := ValidateTOTP(secret, tt.code, tt.at, tt.lastStep)
+			if ok != tt.ok || step != tt.want {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", step, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
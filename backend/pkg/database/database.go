@@ -1,8 +1,13 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jimsyyap/error_app/backend/pkg/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -40,7 +45,8 @@ func New(config *Config) (*DB, error) {
 	dsn := config.BuildDSN()
 	
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger:         logger.Default.LogMode(logger.Info),
+		TranslateError: true, // report constraint violations as gorm errors
 	})
 	if err != nil {
 		return nil, err
@@ -60,15 +66,58 @@ func (db *DB) Initialize() error {
 		&models.MatchSession{},
 		&models.ErrorType{},
 		&models.ErrorLog{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.TOTPCredential{},
+		&models.RecoveryCode{},
+		&models.MFAChallenge{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.LoginThrottle{},
+		&models.LoginLockout{},
+		&models.APIToken{},
+		&models.CoachLink{},
+		&models.SessionAnnotation{},
+		&models.Organization{},
+		&models.OrgMembership{},
+		&models.PlayerProfile{},
+		&models.AuditEvent{},
+		&models.DeviceSession{},
+		&models.MagicLinkToken{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnChallenge{},
+		&models.Point{},
+		&models.PointOutcome{},
 	)
 	if err != nil {
 		return err
 	}
 
+	// Usernames and emails are unique regardless of case
+	if err := db.ensureCaseInsensitiveUsers(); err != nil {
+		return err
+	}
+
+	// Error type names are now unique per organization or user rather than
+	// globally
+	db.Exec("DROP INDEX IF EXISTS idx_error_types_name")
+	db.Exec("DROP INDEX IF EXISTS idx_error_types_global_name")
+
+	// Keep the audit log append-only
+	db.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN RAISE EXCEPTION 'audit_events is append-only'; END;
+		$$ LANGUAGE plpgsql`)
+	db.Exec("DROP TRIGGER IF EXISTS trg_audit_events_append_only ON audit_events")
+	db.Exec("CREATE TRIGGER trg_audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()")
+
 	// Add check constraints that GORM doesn't handle automatically
 	db.Exec("ALTER TABLE match_sessions DROP CONSTRAINT IF EXISTS chk_end_after_start")
 	db.Exec("ALTER TABLE match_sessions ADD CONSTRAINT chk_end_after_start CHECK (end_time IS NULL OR end_time >= start_time)")
 	
+	db.Exec("ALTER TABLE error_types DROP CONSTRAINT IF EXISTS chk_error_type_owner")
+	db.Exec("ALTER TABLE error_types ADD CONSTRAINT chk_error_type_owner CHECK (org_id IS NULL OR user_id IS NULL)")
+
 	db.Exec("ALTER TABLE users DROP CONSTRAINT IF EXISTS chk_email_format")
 	db.Exec("ALTER TABLE users ADD CONSTRAINT chk_email_format CHECK (email ~* '^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\\.[A-Za-z]{2,}$')")
 
@@ -87,6 +136,9 @@ func (db *DB) Initialize() error {
 			{Name: "Overhead"},
 			{Name: "Footwork"},
 		}
+		for i := range errorTypes {
+			errorTypes[i].Attributes = defaultAttributes(errorTypes[i].Name)
+		}
 		result := db.Create(&errorTypes)
 		if result.Error != nil {
 			return result.Error
@@ -94,9 +146,139 @@ func (db *DB) Initialize() error {
 		log.Println("Seeded", result.RowsAffected, "error types")
 	}
 
+	// Error types created before attributes existed get the defaults
+	var untyped []models.ErrorType
+	if err := db.Where("attributes IS NULL").Find(&untyped).Error; err != nil {
+		return err
+	}
+	for _, errorType := range untyped {
+		errorType.Attributes = defaultAttributes(errorType.Name)
+		if err := db.Model(&errorType).Select("attributes").Updates(&errorType).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// defaultAttributes are the attributes an error type gets unless it says
+// otherwise. Serve placement is not a groundstroke direction, and footwork
+// is not a shot at all.
+func defaultAttributes(name string) []string {
+	switch name {
+	case "Serve":
+		return []string{models.AttributeMiss, models.AttributeSpin}
+	case "Footwork":
+		return []string{}
+	}
+	return models.AllAttributes
+}
+
+// ensureCaseInsensitiveUsers adds unique indexes on the lowercased username
+// and email. Accounts created before the indexes may differ only in case;
+// those are listed and the indexes are not created until they are resolved.
+// Usernames with an @ are refused the same way, since login treats any name
+// with one as an email.
+func (db *DB) ensureCaseInsensitiveUsers() error {
+	var emailLike []string
+	if err := db.Model(&models.User{}).Where("username LIKE ?", "%@%").Pluck("username", &emailLike).Error; err != nil {
+		return err
+	}
+	if len(emailLike) > 0 {
+		return fmt.Errorf("usernames contain an @ and cannot sign in, rename them first: %s",
+			strings.Join(emailLike, ", "))
+	}
+
+	for _, column := range []string{"username", "email"} {
+		var collisions []string
+		err := db.Model(&models.User{}).
+			Group("LOWER(" + column + ")").
+			Having("COUNT(*) > 1").
+			Pluck("LOWER("+column+")", &collisions).Error
+		if err != nil {
+			return err
+		}
+		if len(collisions) > 0 {
+			return fmt.Errorf("users differ only in the case of their %s, rename or merge them first: %s",
+				column, strings.Join(collisions, ", "))
+		}
+
+		if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_" + column + "_lower ON users (LOWER(" + column + "))").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BootstrapAdmin promotes the named user to admin if no admin exists yet.
+// It lets the first administrator be created without touching the database.
+func (db *DB) BootstrapAdmin(username string) error {
+	if username == "" {
+		return nil
+	}
+
+	var admins int64
+	if err := db.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	result := db.Model(&models.User{}).Scopes(models.WithUsername(username)).Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("Admin bootstrap: user %q not found, register it and restart", username)
+		return nil
+	}
+	log.Printf("Admin bootstrap: promoted %q to admin", username)
+	return nil
+}
+
+// PurgeDeletedUsers permanently removes accounts whose deletion grace period
+// ended before now, together with their sessions and error logs. The other
+// user tables cascade.
+func (db *DB) PurgeDeletedUsers(now time.Time) (int64, error) {
+	var userIDs []uuid.UUID
+	if err := db.Model(&models.User{}).Where("delete_after < ?", now).Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, userID := range userIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			sessionIDs := tx.Model(&models.MatchSession{}).Select("session_id").Where("user_id = ?", userID)
+			if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.ErrorLog{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", userID).Delete(&models.MatchSession{}).Error; err != nil {
+				return err
+			}
+			// Re-check so an account restored in the meantime survives
+			result := tx.Where("user_id = ? AND delete_after < ?", userID, now).Delete(&models.User{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errAccountRestored
+			}
+			return nil
+		})
+		if errors.Is(err, errAccountRestored) {
+			continue
+		} else if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// errAccountRestored rolls back a purge when the account was restored
+var errAccountRestored = errors.New("account restored")
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	sqlDB, err := db.DB.DB()
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIToken is a personal access token a user creates for scripts and
+// devices. Only the hash of the token is stored.
+type APIToken struct {
+	TokenID    uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"token_id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"` // shown to help users recognise a token
+	Scopes     []string   `gorm:"type:jsonb;serializer:json;not null" json:"scopes"`
+	CreatedAt  time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *APIToken) BeforeCreate(tx *gorm.DB) error {
+	if t.TokenID == uuid.Nil {
+		t.TokenID = uuid.New()
+	}
+	return nil
+}
+
+// IsUsable checks that the token is neither revoked nor expired
+func (t *APIToken) IsUsable() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+// Touch records that the token was used. To avoid a write on every request
+// the timestamp is only updated once a minute.
+func (t *APIToken) Touch(tx *gorm.DB) error {
+	now := time.Now()
+	return tx.Model(&APIToken{}).
+		Where("token_id = ? AND (last_used_at IS NULL OR last_used_at < ?)", t.TokenID, now.Add(-time.Minute)).
+		Update("last_used_at", now).Error
+}
+
+// RevokeUserAPITokens revokes all of a user's active API tokens
+func RevokeUserAPITokens(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audit event actions
+const (
+	AuditRegister        = "user.register"
+	AuditLogin           = "auth.login"
+	AuditLoginFailed     = "auth.login_failed"
+	AuditLogout          = "auth.logout"
+	AuditPasswordReset   = "auth.password_reset"
+	AuditPasswordChanged = "auth.password_changed"
+	AuditRefreshReuse    = "auth.refresh_reuse"
+	AuditMFAEnabled      = "mfa.enabled"
+	AuditMFADisabled     = "mfa.disabled"
+	AuditPasskeyAdded    = "passkey.added"
+	AuditPasskeyRemoved  = "passkey.removed"
+	AuditTokenCreated    = "token.created"
+	AuditTokenRevoked    = "token.revoked"
+	AuditDeviceRevoked   = "device.revoked"
+	AuditAccountDeleted  = "account.deleted"
+	AuditAccountRestored = "account.restored"
+	AuditRoleChanged     = "user.role_changed"
+	AuditAccountDisabled = "user.disabled"
+	AuditAccountEnabled  = "user.enabled"
+	AuditResetForced     = "user.password_reset_forced"
+	AuditImpersonated    = "user.impersonated"
+	AuditSessionEnded    = "session.ended"
+	AuditErrorUndone     = "error.undone"
+	AuditOutcomeUndone   = "outcome.undone"
+)
+
+// AuditEvent records a security-relevant action. The table is append-only;
+// a trigger rejects updates and deletes. Events have no foreign key so they
+// outlive purged accounts.
+type AuditEvent struct {
+	EventID   uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"event_id"`
+	UserID    *uuid.UUID        `gorm:"type:uuid;index" json:"user_id"`      // account the event is about
+	ActorID   *uuid.UUID        `gorm:"type:uuid" json:"actor_id,omitempty"` // who acted, if not the user
+	Action    string            `gorm:"type:varchar(50);not null;index" json:"action"`
+	TargetID  string            `gorm:"type:varchar(64)" json:"target_id,omitempty"` // session, token, etc.
+	IP        string            `gorm:"type:varchar(45)" json:"ip"`
+	UserAgent string            `gorm:"type:varchar(255)" json:"user_agent"`
+	Metadata  map[string]string `gorm:"type:jsonb;serializer:json" json:"metadata,omitempty"`
+	CreatedAt time.Time         `gorm:"not null;default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.EventID == uuid.Nil {
+		e.EventID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Coach link statuses
+const (
+	LinkPending = "pending"
+	LinkActive  = "active"
+	LinkRevoked = "revoked"
+)
+
+// Coach link permissions
+const (
+	PermissionView     = "view"
+	PermissionAnnotate = "annotate"
+)
+
+// CoachLink grants a coach read access to a player's sessions once the
+// invited side has accepted it. Either side can revoke it.
+type CoachLink struct {
+	LinkID     uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"link_id"`
+	CoachID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"coach_id"`
+	Coach      User       `gorm:"foreignKey:CoachID;constraint:OnDelete:CASCADE" json:"-"`
+	PlayerID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"player_id"`
+	Player     User       `gorm:"foreignKey:PlayerID;constraint:OnDelete:CASCADE" json:"-"`
+	InvitedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"invited_by"`
+	Status     string     `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	Permission string     `gorm:"type:varchar(20);not null;default:'view'" json:"permission"`
+	CreatedAt  time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (l *CoachLink) BeforeCreate(tx *gorm.DB) error {
+	if l.LinkID == uuid.Nil {
+		l.LinkID = uuid.New()
+	}
+	return nil
+}
+
+// IsParty checks if the user is the coach or the player of the link
+func (l *CoachLink) IsParty(userID uuid.UUID) bool {
+	return l.CoachID == userID || l.PlayerID == userID
+}
+
+// CanAnnotate checks if the link lets the coach annotate sessions
+func (l *CoachLink) CanAnnotate() bool {
+	return l.Status == LinkActive && l.Permission == PermissionAnnotate
+}
+
+// IsValidPermission checks if permission is a known coach link permission
+func IsValidPermission(permission string) bool {
+	return permission == PermissionView || permission == PermissionAnnotate
+}
+
+// SessionAnnotation is a note a coach leaves on a player's session,
+// optionally pointing at one logged error
+type SessionAnnotation struct {
+	AnnotationID uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"annotation_id"`
+	SessionID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"session_id"`
+	Session      MatchSession `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE" json:"-"`
+	ErrorID      *uuid.UUID   `gorm:"type:uuid" json:"error_id,omitempty"`
+	ErrorLog     *ErrorLog    `gorm:"foreignKey:ErrorID;constraint:OnDelete:CASCADE" json:"-"`
+	AuthorID     uuid.UUID    `gorm:"type:uuid;not null" json:"author_id"`
+	Author       User         `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE" json:"-"`
+	Body         string       `gorm:"type:text;not null" json:"body"`
+	CreatedAt    time.Time    `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (a *SessionAnnotation) BeforeCreate(tx *gorm.DB) error {
+	if a.AnnotationID == uuid.Nil {
+		a.AnnotationID = uuid.New()
+	}
+	return nil
+}
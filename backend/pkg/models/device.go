@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeviceSession is one signed-in device. It shares its ID with the refresh
+// token family started at login, and access tokens carry it as the sid
+// claim so revoking the device rejects them immediately.
+type DeviceSession struct {
+	DeviceID   uuid.UUID  `gorm:"type:uuid;primary_key" json:"device_id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent"`
+	IP         string     `gorm:"type:varchar(45)" json:"ip"`
+	CreatedAt  time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastSeenAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Set when an admin signed in as the user for support
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid" json:"impersonator_id,omitempty"`
+}
+
+// IsRevoked checks if the device has been signed out
+func (d *DeviceSession) IsRevoked() bool {
+	return d.RevokedAt != nil
+}
+
+// RecordDeviceSession creates the device session on login and refreshes its
+// last use, address and user agent on later token refreshes
+func RecordDeviceSession(tx *gorm.DB, device *DeviceSession) error {
+	now := time.Now()
+	device.CreatedAt, device.LastSeenAt = now, now
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_agent", "ip", "last_seen_at"}),
+	}).Create(device).Error
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailVerificationToken represents a single-use email verification token.
+// Only the hash of the token is stored.
+type EmailVerificationToken struct {
+	TokenID   uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"token_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	CreatedAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP;index" json:"created_at"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *EmailVerificationToken) BeforeCreate(tx *gorm.DB) error {
+	if t.TokenID == uuid.Nil {
+		t.TokenID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired checks if the verification token has passed its expiry time
+func (t *EmailVerificationToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// Consume marks the token as used. It reports false if the token had
+// already been used.
+func (t *EmailVerificationToken) Consume(tx *gorm.DB) (bool, error) {
+	now := time.Now()
+	result := tx.Model(&EmailVerificationToken{}).
+		Where("token_id = ? AND used_at IS NULL", t.TokenID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	t.UsedAt = &now
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateEmailVerifications marks all outstanding verification tokens of a
+// user as used
+func InvalidateEmailVerifications(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
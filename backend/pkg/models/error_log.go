@@ -1,10 +1,13 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
 )
 
 // ErrorLog represents a logged error during a tennis match
@@ -15,6 +18,64 @@ type ErrorLog struct {
 	ErrorTypeID int       `gorm:"not null" json:"error_type_id"`
 	ErrorType   ErrorType `gorm:"foreignKey:ErrorTypeID" json:"error_type,omitempty"`
 	Timestamp   time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;index" json:"timestamp"`
+	PointContext `gorm:"embedded"`
+	ErrorAttributes `gorm:"embedded"`
+}
+
+// ErrorAttributes classify an error beyond its type. Which ones an error
+// may carry depends on its type.
+type ErrorAttributes struct {
+	Miss      *string `gorm:"type:varchar(20)" json:"miss,omitempty"`      // net, long or wide
+	Direction *string `gorm:"type:varchar(20)" json:"direction,omitempty"` // crosscourt, down_the_line or middle
+	Spin      *string `gorm:"type:varchar(20)" json:"spin,omitempty"`      // flat, topspin or slice
+}
+
+// Validate checks every attribute set is allowed for the error type and
+// has a known value
+func (a ErrorAttributes) Validate(t *ErrorType) error {
+	for _, attr := range []struct {
+		name  string
+		value *string
+	}{
+		{AttributeMiss, a.Miss},
+		{AttributeDirection, a.Direction},
+		{AttributeSpin, a.Spin},
+	} {
+		if attr.value == nil {
+			continue
+		}
+		if !t.Allows(attr.name) {
+			return fmt.Errorf("%w: %s", ErrAttributeNotAllowed, attr.name)
+		}
+		if !contains(AttributeValues[attr.name], *attr.value) {
+			return fmt.Errorf("%w: %s %q", ErrInvalidAttributeValue, attr.name, *attr.value)
+		}
+	}
+	return nil
+}
+
+// PointContext places an error in the match. Every field is optional; they
+// are derived from the score when the session is being scored.
+type PointContext struct {
+	SetNumber   *int    `json:"set_number,omitempty"`
+	GameNumber  *int    `json:"game_number,omitempty"`  // game of the set; a tiebreak follows the last game
+	PointNumber *int    `json:"point_number,omitempty"` // point of the game or tiebreak
+	Server      *string `gorm:"type:varchar(10)" json:"server,omitempty"`
+	BreakPoint  *bool   `json:"break_point,omitempty"`
+	SetPoint    *bool   `json:"set_point,omitempty"`
+}
+
+// NewPointContext records the situation of the point being played
+func NewPointContext(s scoring.Situation) PointContext {
+	server := string(s.Server)
+	return PointContext{
+		SetNumber:   &s.Set,
+		GameNumber:  &s.Game,
+		PointNumber: &s.Point,
+		Server:      &server,
+		BreakPoint:  &s.BreakPoint,
+		SetPoint:    &s.SetPoint,
+	}
 }
 
 // BeforeCreate will set a UUID rather than numeric ID
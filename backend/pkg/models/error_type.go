@@ -1,7 +1,94 @@
 package models
 
-// ErrorType represents a type of tennis error (e.g., Forehand, Backhand)
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrorType represents a type of tennis error (e.g., Forehand, Backhand).
+// Types without an organization or user are the global defaults; the others
+// are custom types layered over them and visible only to that
+// organization's members or that user.
+//
+// Types form a hierarchy through their parent, such as Serve > Double
+// Fault. They are archived rather than deleted so the errors logged with
+// them stay valid.
 type ErrorType struct {
-	ErrorTypeID int    `gorm:"primaryKey;autoIncrement" json:"error_type_id"`
-	Name        string `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	ErrorTypeID int        `gorm:"primaryKey;autoIncrement" json:"error_type_id"`
+	Name        string     `gorm:"type:varchar(50);not null;uniqueIndex:idx_error_types_default_name,where:org_id IS NULL AND user_id IS NULL;uniqueIndex:idx_error_types_org_name,priority:2;uniqueIndex:idx_error_types_user_name,priority:2" json:"name"`
+	OrgID       *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_error_types_org_name,priority:1" json:"org_id,omitempty"`
+	UserID      *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_error_types_user_name,priority:1" json:"user_id,omitempty"`
+	User        *User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	ParentID    *int       `gorm:"index" json:"parent_id,omitempty"`
+	Parent      *ErrorType `gorm:"foreignKey:ParentID" json:"-"`
+	Position    int        `gorm:"not null;default:0" json:"position"`           // order in the logging UI, then by ID
+	Color       *string    `gorm:"type:varchar(7)" json:"color,omitempty"`       // #rrggbb
+	Attributes  []string   `gorm:"type:jsonb;serializer:json" json:"attributes"` // attributes errors of this type may carry
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+}
+
+// MaxErrorTypeDepth limits how many ancestors an error type can have
+const MaxErrorTypeDepth = 5
+
+// ErrInvalidParent is returned for a parent error type that is not visible
+// wherever the child is, is archived, or would make a cycle or nest too deep
+var ErrInvalidParent = errors.New("invalid parent error type")
+
+// Error attributes and their values
+const (
+	AttributeMiss      = "miss"
+	AttributeDirection = "direction"
+	AttributeSpin      = "spin"
+)
+
+// AttributeValues lists the values each error attribute can take
+var AttributeValues = map[string][]string{
+	AttributeMiss:      {"net", "long", "wide"},
+	AttributeDirection: {"crosscourt", "down_the_line", "middle"},
+	AttributeSpin:      {"flat", "topspin", "slice"},
+}
+
+// AllAttributes are the attributes of stroke error types
+var AllAttributes = []string{AttributeMiss, AttributeDirection, AttributeSpin}
+
+// Error attribute validation errors
+var (
+	ErrInvalidAttributeValue = errors.New("invalid attribute value")
+	ErrAttributeNotAllowed   = errors.New("attribute is not allowed for this error type")
+)
+
+// IsArchived checks if the type has been archived
+func (t *ErrorType) IsArchived() bool {
+	return t.ArchivedAt != nil
+}
+
+// Archive hides the type from the logging UI and stops new errors being
+// logged with it
+func (t *ErrorType) Archive(tx *gorm.DB) error {
+	now := time.Now()
+	t.ArchivedAt = &now
+	return tx.Model(t).Update("archived_at", now).Error
+}
+
+// Restore undoes Archive
+func (t *ErrorType) Restore(tx *gorm.DB) error {
+	t.ArchivedAt = nil
+	return tx.Model(t).Update("archived_at", nil).Error
+}
+
+// Allows checks if errors of the type may carry an attribute
+func (t *ErrorType) Allows(attribute string) bool {
+	return contains(t.Attributes, attribute)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	IdentityID uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"identity_id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Provider   string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject    string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email      string    `gorm:"type:varchar(100)" json:"email"`
+	CreatedAt  time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.IdentityID == uuid.Nil {
+		i.IdentityID = uuid.New()
+	}
+	return nil
+}
+
+// OIDCLoginState holds the state, nonce and PKCE verifier of an
+// authorization request until the provider redirects back
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"type:varchar(64);primary_key" json:"-"`
+	Provider     string    `gorm:"type:varchar(50);not null" json:"provider"`
+	Nonce        string    `gorm:"type:varchar(64);not null" json:"-"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null" json:"-"`
+	CreatedAt    time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// IsExpired checks if the login state has passed its expiry time
+func (s *OIDCLoginState) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
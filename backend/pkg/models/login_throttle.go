@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginThrottle tracks recent failed logins for one key, such as an
+// account name or a client IP
+type LoginThrottle struct {
+	ThrottleKey   string     `gorm:"type:varchar(150);primary_key" json:"throttle_key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// LoginLockout is an append-only record of a temporary lockout, kept so
+// administrators can see who was locked out and why
+type LoginLockout struct {
+	LockoutID   uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"lockout_id"`
+	Scope       string    `gorm:"type:varchar(20);not null;index" json:"scope"`
+	Subject     string    `gorm:"type:varchar(150);not null;index" json:"subject"`
+	Failures    int       `gorm:"not null" json:"failures"`
+	LockedAt    time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;index" json:"locked_at"`
+	LockedUntil time.Time `gorm:"not null" json:"locked_until"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (l *LoginLockout) BeforeCreate(tx *gorm.DB) error {
+	if l.LockoutID == uuid.Nil {
+		l.LockoutID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MagicLinkToken represents a single-use passwordless sign-in link.
+// Only the hash of the token is stored.
+type MagicLinkToken struct {
+	TokenID   uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"token_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	CreatedAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *MagicLinkToken) BeforeCreate(tx *gorm.DB) error {
+	if t.TokenID == uuid.Nil {
+		t.TokenID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired checks if the link has passed its expiry time
+func (t *MagicLinkToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// Consume marks the link as used. It reports false if the link had already
+// been used.
+func (t *MagicLinkToken) Consume(tx *gorm.DB) (bool, error) {
+	now := time.Now()
+	result := tx.Model(&MagicLinkToken{}).
+		Where("token_id = ? AND used_at IS NULL", t.TokenID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	t.UsedAt = &now
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateMagicLinks marks all outstanding sign-in links of a user as used
+func InvalidateMagicLinks(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&MagicLinkToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
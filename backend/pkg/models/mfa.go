@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TOTPCredential holds a user's authenticator app secret. It only protects
+// logins once ConfirmedAt is set.
+type TOTPCredential struct {
+	UserID       uuid.UUID  `gorm:"type:uuid;primary_key" json:"user_id"`
+	User         User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Secret       string     `gorm:"type:varchar(64);not null" json:"-"`
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+}
+
+// IsConfirmed checks if enrolment has been completed
+func (t *TOTPCredential) IsConfirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+// RecoveryCode is a hashed one-time code that can stand in for a TOTP code
+type RecoveryCode struct {
+	CodeID   uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"code_id"`
+	UserID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User     User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	CodeHash string     `gorm:"type:varchar(64);not null;index" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (r *RecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if r.CodeID == uuid.Nil {
+		r.CodeID = uuid.New()
+	}
+	return nil
+}
+
+// MFAChallenge is the intermediate state between a correct password and a
+// correct second factor. Only the hash of the challenge token is stored.
+type MFAChallenge struct {
+	ChallengeID uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"challenge_id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	TokenHash   string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	CreatedAt   time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (m *MFAChallenge) BeforeCreate(tx *gorm.DB) error {
+	if m.ChallengeID == uuid.Nil {
+		m.ChallengeID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired checks if the challenge has passed its expiry time
+func (m *MFAChallenge) IsExpired() bool {
+	return time.Now().After(m.ExpiresAt)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Organization roles
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleCoach  = "coach"
+	OrgRoleMember = "member"
+)
+
+// Organization is a club or team. Sessions and custom error types that
+// belong to an organization are only visible to its members.
+type Organization struct {
+	OrgID     uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"org_id"`
+	Name      string    `gorm:"type:varchar(100);not null" json:"name"`
+	Slug      string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"slug"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.OrgID == uuid.Nil {
+		o.OrgID = uuid.New()
+	}
+	return nil
+}
+
+// OrgMembership gives a user a role in an organization
+type OrgMembership struct {
+	OrgID        uuid.UUID    `gorm:"type:uuid;primaryKey" json:"org_id"`
+	Organization Organization `gorm:"foreignKey:OrgID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID       uuid.UUID    `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	User         User         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Role         string       `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	CreatedAt    time.Time    `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// IsStaff checks if the member can see other members' sessions and manage
+// the organization's error types
+func (m *OrgMembership) IsStaff() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleCoach
+}
+
+// IsValidOrgRole checks if role is a known organization role
+func IsValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleOwner, OrgRoleCoach, OrgRoleMember:
+		return true
+	}
+	return false
+}
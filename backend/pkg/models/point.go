@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
+)
+
+// Point is one point of a scored session. The score is replayed from the
+// session's points in sequence order.
+type Point struct {
+	PointID   uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"point_id"`
+	SessionID uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex:idx_points_session_sequence" json:"session_id"`
+	Session   MatchSession `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE" json:"-"`
+	Sequence  int          `gorm:"not null;uniqueIndex:idx_points_session_sequence" json:"sequence"` // 1 for the first point
+	Winner    scoring.Side `gorm:"type:varchar(10);not null" json:"winner"`
+	Timestamp time.Time    `gorm:"not null;default:CURRENT_TIMESTAMP" json:"timestamp"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (p *Point) BeforeCreate(tx *gorm.DB) error {
+	if p.PointID == uuid.Nil {
+		p.PointID = uuid.New()
+	}
+	return nil
+}
+
+// ReplayScore scores a session from its recorded points. It returns nil for
+// sessions that are not being scored.
+func ReplayScore(tx *gorm.DB, session *MatchSession) (*scoring.State, error) {
+	if !session.IsScored() {
+		return nil, nil
+	}
+
+	var winners []scoring.Side
+	if err := tx.Model(&Point{}).Where("session_id = ?", session.SessionID).
+		Order("sequence").Pluck("winner", &winners).Error; err != nil {
+		return nil, err
+	}
+	return scoring.Replay(*session.ScoringFormat, scoring.Side(*session.FirstServer), winners)
+}
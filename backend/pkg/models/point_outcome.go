@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
+)
+
+// OutcomeKind is how a point ended
+type OutcomeKind string
+
+// Point outcome kinds
+const (
+	OutcomeWinner        OutcomeKind = "winner"
+	OutcomeForcedError   OutcomeKind = "forced_error"
+	OutcomeUnforcedError OutcomeKind = "unforced_error"
+	OutcomeAce           OutcomeKind = "ace"
+	OutcomeDoubleFault   OutcomeKind = "double_fault"
+)
+
+// ShotType is the shot that ended a point
+type ShotType string
+
+// Shot types
+const (
+	ShotForehand ShotType = "forehand"
+	ShotBackhand ShotType = "backhand"
+	ShotServe    ShotType = "serve"
+	ShotReturn   ShotType = "return"
+	ShotVolley   ShotType = "volley"
+	ShotOverhead ShotType = "overhead"
+	ShotDropShot ShotType = "drop_shot"
+	ShotLob      ShotType = "lob"
+)
+
+// Point outcome validation errors
+var (
+	ErrInvalidOutcomeKind = errors.New("kind must be winner, forced_error, unforced_error, ace or double_fault")
+	ErrInvalidShotType    = errors.New("shot must be forehand, backhand, serve, return, volley, overhead, drop_shot or lob")
+	ErrServeOutcome       = errors.New("aces and double faults are serves")
+)
+
+// IsValid checks if k is a known outcome kind
+func (k OutcomeKind) IsValid() bool {
+	switch k {
+	case OutcomeWinner, OutcomeForcedError, OutcomeUnforcedError, OutcomeAce, OutcomeDoubleFault:
+		return true
+	}
+	return false
+}
+
+// IsValid checks if t is a known shot type
+func (t ShotType) IsValid() bool {
+	switch t {
+	case ShotForehand, ShotBackhand, ShotServe, ShotReturn, ShotVolley, ShotOverhead, ShotDropShot, ShotLob:
+		return true
+	}
+	return false
+}
+
+// errorTypeShots maps the default root error types to the shot they are
+// errors of
+var errorTypeShots = map[string]ShotType{
+	"forehand":  ShotForehand,
+	"backhand":  ShotBackhand,
+	"serve":     ShotServe,
+	"return":    ShotReturn,
+	"volley":    ShotVolley,
+	"overhead":  ShotOverhead,
+	"drop shot": ShotDropShot,
+	"lob":       ShotLob,
+}
+
+// ShotForErrorType returns the shot of an error type given the name of its
+// root type, so Serve > Double Fault is a serve. Types such as Footwork are
+// not a shot.
+func ShotForErrorType(rootName string) (ShotType, bool) {
+	shot, ok := errorTypeShots[strings.ToLower(strings.TrimSpace(rootName))]
+	return shot, ok
+}
+
+// PointOutcome records how a point ended: the kind of outcome, the shot
+// that ended it and who hit that shot. The player's unforced errors are
+// logged as ErrorLog instead and counted with the outcomes in summaries. In
+// a scored session each outcome records its point.
+type PointOutcome struct {
+	OutcomeID    uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"outcome_id"`
+	SessionID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"session_id"`
+	Session      MatchSession `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE" json:"-"`
+	Kind         OutcomeKind  `gorm:"type:varchar(20);not null" json:"kind"`
+	Shot         ShotType     `gorm:"type:varchar(20);not null" json:"shot"`
+	Player       scoring.Side `gorm:"type:varchar(10);not null" json:"player"` // hit the shot
+	PointID      *uuid.UUID   `gorm:"type:uuid;index" json:"point_id,omitempty"`
+	Point        *Point       `gorm:"foreignKey:PointID;constraint:OnDelete:CASCADE" json:"-"`
+	Timestamp    time.Time    `gorm:"not null;default:CURRENT_TIMESTAMP;index" json:"timestamp"`
+	PointContext `gorm:"embedded"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (o *PointOutcome) BeforeCreate(tx *gorm.DB) error {
+	if o.OutcomeID == uuid.Nil {
+		o.OutcomeID = uuid.New()
+	}
+	return nil
+}
+
+// PointWinner returns the side that won the point: the hitter of a winner
+// or ace, otherwise the other side
+func (o *PointOutcome) PointWinner() scoring.Side {
+	if o.Kind == OutcomeWinner || o.Kind == OutcomeAce {
+		return o.Player
+	}
+	return o.Player.Other()
+}
+
+// Validate checks the kind, shot and player go together
+func (o *PointOutcome) Validate() error {
+	if !o.Kind.IsValid() {
+		return ErrInvalidOutcomeKind
+	}
+	if !o.Shot.IsValid() {
+		return ErrInvalidShotType
+	}
+	if !o.Player.IsValid() {
+		return scoring.ErrInvalidSide
+	}
+	if (o.Kind == OutcomeAce || o.Kind == OutcomeDoubleFault) && o.Shot != ShotServe {
+		return ErrServeOutcome
+	}
+	return nil
+}
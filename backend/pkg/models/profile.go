@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Dominant hands
+const (
+	HandRight = "right"
+	HandLeft  = "left"
+)
+
+// Backhand styles
+const (
+	BackhandOneHanded = "one_handed"
+	BackhandTwoHanded = "two_handed"
+)
+
+// Court surfaces
+const (
+	SurfaceHard   = "hard"
+	SurfaceClay   = "clay"
+	SurfaceGrass  = "grass"
+	SurfaceCarpet = "carpet"
+)
+
+// Profile validation errors
+var (
+	ErrInvalidDisplayName = errors.New("display_name must be at most 100 characters")
+	ErrInvalidHand        = errors.New("dominant_hand must be right or left")
+	ErrInvalidBackhand    = errors.New("backhand must be one_handed or two_handed")
+	ErrInvalidNTRP        = errors.New("ntrp_rating must be between 1.0 and 7.0 in steps of 0.5")
+	ErrInvalidUTR         = errors.New("utr_rating must be between 1.00 and 16.50")
+	ErrInvalidTimeZone    = errors.New("time_zone must be an IANA time zone such as Europe/London")
+	ErrInvalidSurface     = errors.New("preferred_surface must be hard, clay, grass or carpet")
+)
+
+// PlayerProfile holds the tennis-specific details of a user. Every field is
+// optional; a user without a row simply has an empty profile.
+type PlayerProfile struct {
+	UserID           uuid.UUID `gorm:"type:uuid;primary_key" json:"-"`
+	User             User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	DisplayName      *string   `gorm:"type:varchar(100)" json:"display_name"`
+	DominantHand     *string   `gorm:"type:varchar(10)" json:"dominant_hand"`
+	Backhand         *string   `gorm:"type:varchar(20)" json:"backhand"`
+	NTRPRating       *float64  `gorm:"type:numeric(2,1)" json:"ntrp_rating"`
+	UTRRating        *float64  `gorm:"type:numeric(4,2)" json:"utr_rating"`
+	TimeZone         *string   `gorm:"type:varchar(64)" json:"time_zone"`
+	PreferredSurface *string   `gorm:"type:varchar(20)" json:"preferred_surface"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Validate checks every set field of the profile
+func (p *PlayerProfile) Validate() error {
+	if p.DisplayName != nil && utf8.RuneCountInString(*p.DisplayName) > 100 {
+		return ErrInvalidDisplayName
+	}
+	if p.DominantHand != nil && *p.DominantHand != HandRight && *p.DominantHand != HandLeft {
+		return ErrInvalidHand
+	}
+	if p.Backhand != nil && *p.Backhand != BackhandOneHanded && *p.Backhand != BackhandTwoHanded {
+		return ErrInvalidBackhand
+	}
+	if p.NTRPRating != nil {
+		r := *p.NTRPRating
+		if r < 1 || r > 7 || math.Mod(r*2, 1) != 0 {
+			return ErrInvalidNTRP
+		}
+	}
+	if p.UTRRating != nil && (*p.UTRRating < 1 || *p.UTRRating > 16.5) {
+		return ErrInvalidUTR
+	}
+	if p.TimeZone != nil {
+		if *p.TimeZone == "" || *p.TimeZone == "Local" {
+			return ErrInvalidTimeZone
+		}
+		if _, err := time.LoadLocation(*p.TimeZone); err != nil {
+			return ErrInvalidTimeZone
+		}
+	}
+	if p.PreferredSurface != nil {
+		switch *p.PreferredSurface {
+		case SurfaceHard, SurfaceClay, SurfaceGrass, SurfaceCarpet:
+		default:
+			return ErrInvalidSurface
+		}
+	}
+	return nil
+}
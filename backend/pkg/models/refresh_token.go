@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken represents a rotating refresh token issued at login.
+// Tokens issued from the same login share a FamilyID so that the whole
+// chain can be revoked at once.
+type RefreshToken struct {
+	TokenID   uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"token_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	FamilyID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"family_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	CreatedAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.TokenID == uuid.Nil {
+		t.TokenID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired checks if the refresh token has passed its expiry time
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// MarkUsed marks the token as rotated. It reports false if the token had
+// already been used, which means it is being replayed.
+func (t *RefreshToken) MarkUsed(tx *gorm.DB) (bool, error) {
+	now := time.Now()
+	result := tx.Model(&RefreshToken{}).
+		Where("token_id = ? AND used_at IS NULL AND revoked_at IS NULL", t.TokenID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	t.UsedAt = &now
+	return true, nil
+}
+
+// RevokeRefreshFamily revokes every outstanding token in a refresh family
+// and signs out the device session it belongs to
+func RevokeRefreshFamily(tx *gorm.DB, familyID uuid.UUID) error {
+	now := time.Now()
+	if err := tx.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&DeviceSession{}).
+		Where("device_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user
+// and signs out all of their devices
+func RevokeUserRefreshTokens(tx *gorm.DB, userID uuid.UUID) error {
+	now := time.Now()
+	if err := tx.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&DeviceSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"github.com/jimsyyap/error_app/backend/pkg/scoring"
 )
 
 // MatchSession represents a tennis match session
@@ -12,11 +14,14 @@ type MatchSession struct {
 	SessionID    uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"session_id"`
 	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
 	User         User      `gorm:"foreignKey:UserID" json:"-"`
+	OrgID        *uuid.UUID `gorm:"type:uuid;index" json:"org_id,omitempty"`
 	StartTime    time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"start_time"`
 	EndTime      *time.Time `json:"end_time"`
 	OpponentName *string   `gorm:"type:varchar(100)" json:"opponent_name,omitempty"`
 	Location     *string   `gorm:"type:varchar(100)" json:"location,omitempty"`
-	Score        *string   `gorm:"type:varchar(50)" json:"score,omitempty"`
+	Score        *string   `gorm:"type:varchar(100)" json:"score,omitempty"` // kept up to date from the points once scoring starts
+	ScoringFormat *scoring.Format `gorm:"type:jsonb;serializer:json" json:"scoring_format,omitempty"`
+	FirstServer  *string   `gorm:"type:varchar(10)" json:"first_server,omitempty"`
 	Notes        *string   `gorm:"type:text" json:"notes,omitempty"`
 	ErrorLogs    []ErrorLog `gorm:"foreignKey:SessionID" json:"error_logs,omitempty"`
 }
@@ -34,6 +39,11 @@ func (s *MatchSession) IsActive() bool {
 	return s.EndTime == nil
 }
 
+// IsScored checks if the session's points are being recorded
+func (s *MatchSession) IsScored() bool {
+	return s.ScoringFormat != nil && s.FirstServer != nil
+}
+
 // End marks a session as ended
 func (s *MatchSession) End(tx *gorm.DB) error {
 	now := time.Now()
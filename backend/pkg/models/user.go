@@ -7,14 +7,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleAdmin  = "admin"
+	RoleCoach  = "coach"
+	RolePlayer = "player"
+)
+
 // User represents a user of the Tennis Error Tracker application
 type User struct {
 	UserID       uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"user_id"`
 	Username     string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"username"`
 	Email        string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"email"`
 	PasswordHash string    `gorm:"type:varchar(255);not null" json:"-"`
+	Role         string    `gorm:"type:varchar(20);not null;default:'player'" json:"role"`
 	CreatedAt    time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	LastLogin    *time.Time `json:"last_login"`
+	VerifiedAt   *time.Time `json:"verified_at"`
+	DeleteAfter  *time.Time `gorm:"index" json:"delete_after,omitempty"` // set while deletion is pending
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`                // set while an admin has disabled the account
+	PasswordResetRequired bool `gorm:"not null;default:false" json:"password_reset_required"`
 	Sessions     []MatchSession `gorm:"foreignKey:UserID" json:"sessions,omitempty"`
 }
 
@@ -23,6 +35,9 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.UserID == uuid.Nil {
 		u.UserID = uuid.New()
 	}
+	if u.Role == "" {
+		u.Role = RolePlayer
+	}
 	return nil
 }
 
@@ -32,3 +47,77 @@ func (u *User) UpdateLastLogin(tx *gorm.DB) error {
 	u.LastLogin = &now
 	return tx.Model(u).Update("last_login", now).Error
 }
+
+// IsVerified checks if the user has confirmed their email address
+func (u *User) IsVerified() bool {
+	return u.VerifiedAt != nil
+}
+
+// MarkVerified records that the user has confirmed their email address
+func (u *User) MarkVerified(tx *gorm.DB) error {
+	now := time.Now()
+	u.VerifiedAt = &now
+	return tx.Model(u).Update("verified_at", now).Error
+}
+
+// IsPendingDeletion checks if the user has deleted their account and it is
+// waiting to be purged. Such accounts cannot sign in.
+func (u *User) IsPendingDeletion() bool {
+	return u.DeleteAfter != nil
+}
+
+// ScheduleDeletion marks the account for purging after the given time
+func (u *User) ScheduleDeletion(tx *gorm.DB, after time.Time) error {
+	u.DeleteAfter = &after
+	return tx.Model(u).Update("delete_after", after).Error
+}
+
+// CancelDeletion restores an account that is pending deletion
+func (u *User) CancelDeletion(tx *gorm.DB) error {
+	u.DeleteAfter = nil
+	return tx.Model(u).Update("delete_after", nil).Error
+}
+
+// IsDisabled checks if an admin has disabled the account. Disabled
+// accounts cannot sign in or use existing tokens.
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// Disable blocks the account until it is enabled again
+func (u *User) Disable(tx *gorm.DB) error {
+	now := time.Now()
+	u.DisabledAt = &now
+	return tx.Model(u).Update("disabled_at", now).Error
+}
+
+// Enable lifts a block set by Disable
+func (u *User) Enable(tx *gorm.DB) error {
+	u.DisabledAt = nil
+	return tx.Model(u).Update("disabled_at", nil).Error
+}
+
+// WithUsername matches a username regardless of case. Usernames are unique
+// case-insensitively, so at most one user matches.
+func WithUsername(username string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("LOWER(username) = LOWER(?)", username)
+	}
+}
+
+// WithEmail matches an email address regardless of case. Addresses are
+// unique case-insensitively, so at most one user matches.
+func WithEmail(email string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("LOWER(email) = LOWER(?)", email)
+	}
+}
+
+// IsValidRole checks if role is one of the known user roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleCoach, RolePlayer:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthn ceremonies a challenge can be used for
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential is a passkey registered to a user. The stored sign
+// count is compared on every login to detect cloned authenticators.
+type WebAuthnCredential struct {
+	CredentialID    uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"credential_id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	User            User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Name            string     `gorm:"type:varchar(100);not null" json:"name"`
+	RawID           []byte     `gorm:"type:bytea;uniqueIndex;not null" json:"-"`
+	PublicKey       []byte     `gorm:"type:bytea;not null" json:"-"`
+	AttestationType string     `gorm:"type:varchar(50)" json:"-"`
+	AAGUID          []byte     `gorm:"type:bytea" json:"-"`
+	SignCount       int64      `gorm:"not null;default:0" json:"-"`
+	Transports      []string   `gorm:"type:jsonb;serializer:json" json:"transports"`
+	BackupEligible  bool       `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState     bool       `gorm:"not null;default:false" json:"backup_state"`
+	CreatedAt       time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+}
+
+// BeforeCreate will set a UUID rather than numeric ID
+func (w *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if w.CredentialID == uuid.Nil {
+		w.CredentialID = uuid.New()
+	}
+	return nil
+}
+
+// RecordUse stores the sign count and backup state reported by a successful
+// login. The update only applies while the stored count is still the one
+// that was checked, so two logins racing with the same count cannot both
+// succeed. It reports false if the count had already moved.
+func (w *WebAuthnCredential) RecordUse(tx *gorm.DB, signCount uint32, backupState bool) (bool, error) {
+	now := time.Now()
+	result := tx.Model(&WebAuthnCredential{}).
+		Where("credential_id = ? AND sign_count = ?", w.CredentialID, w.SignCount).
+		Updates(map[string]interface{}{
+			"sign_count":   int64(signCount),
+			"backup_state": backupState,
+			"last_used_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	w.SignCount, w.BackupState, w.LastUsedAt = int64(signCount), backupState, &now
+	return result.RowsAffected == 1, nil
+}
+
+// WebAuthnChallenge holds the server side of a registration or login
+// ceremony until the authenticator's response comes back. Only the hash of
+// the handle given to the client is stored, and the row is deleted when
+// used so it is single-use.
+type WebAuthnChallenge struct {
+	HandleHash  string     `gorm:"type:varchar(64);primary_key" json:"-"`
+	UserID      *uuid.UUID `gorm:"type:uuid;index" json:"user_id"` // nil for discoverable logins
+	Ceremony    string     `gorm:"type:varchar(20);not null" json:"ceremony"`
+	SessionData []byte     `gorm:"type:jsonb;not null" json:"-"`
+	CreatedAt   time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+}
+
+// IsExpired checks if the challenge has passed its expiry time
+func (w *WebAuthnChallenge) IsExpired() bool {
+	return time.Now().After(w.ExpiresAt)
+}
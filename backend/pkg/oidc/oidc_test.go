@@ -0,0 +1,193 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/jimsyyap/error_app/backend/pkg/oidc"
+	"github.com/jimsyyap/error_app/backend/pkg/oidc/oidctest"
+)
+
+const (
+	clientID    = "tennis-app"
+	redirectURL = "http://app.test/oidc/mock/callback"
+)
+
+var alice = oidctest.Identity{
+	Subject:       "alice-subject",
+	Email:         "alice@example.com",
+	EmailVerified: true,
+	Name:          "Alice",
+}
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+
+	idp, err := oidctest.NewServer(clientID, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name:        "mock",
+		Issuer:      idp.Issuer(),
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idp, provider
+}
+
+// authorize follows the authorization URL to the provider and returns the
+// code and state it redirects back with
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != redirectURL {
+		t.Fatalf("redirected to %q, want %q", got, redirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestCodeFlowWithPKCE(t *testing.T) {
+	_, provider := newProvider(t)
+	ctx := context.Background()
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := authorize(t, provider.AuthCodeURL("the-state", "the-nonce", verifier))
+	if state != "the-state" {
+		t.Fatalf("state = %q, want the-state", state)
+	}
+
+	tokens, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, tokens.IDToken, "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != alice.Subject || claims.Email != alice.Email || !claims.EmailVerified {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	// Codes are single-use
+	if _, err := provider.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("code was accepted twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	_, provider := newProvider(t)
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, provider.AuthCodeURL("state", "nonce", verifier))
+
+	if _, err := provider.Exchange(context.Background(), code, "not-the-verifier"); err == nil {
+		t.Fatal("code was exchanged without the PKCE verifier")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp, provider := newProvider(t)
+
+	tests := []struct {
+		name   string
+		nonce  string
+		modify func(*oidc.Claims)
+		want   error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:  "wrong nonce",
+			nonce: "another-nonce",
+			want:  oidc.ErrNonceMismatch,
+		},
+		{
+			name:   "wrong audience",
+			modify: func(c *oidc.Claims) { c.Audience = jwt.ClaimStrings{"another-client"} },
+			want:   oidc.ErrInvalidIDToken,
+		},
+		{
+			name:   "wrong issuer",
+			modify: func(c *oidc.Claims) { c.Issuer = "https://evil.example.com" },
+			want:   oidc.ErrInvalidIDToken,
+		},
+		{
+			name: "expired",
+			modify: func(c *oidc.Claims) {
+				c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			},
+			want: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:   "missing expiry",
+			modify: func(c *oidc.Claims) { c.ExpiresAt = nil },
+			want:   oidc.ErrInvalidIDToken,
+		},
+		{
+			name:   "missing subject",
+			modify: func(c *oidc.Claims) { c.Subject = "" },
+			want:   oidc.ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.Claims(alice, "the-nonce")
+			if tt.modify != nil {
+				tt.modify(&claims)
+			}
+			raw, err := idp.SignIDToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = "the-nonce"
+			}
+			_, err = provider.VerifyIDToken(context.Background(), raw, nonce)
+			if tt.want == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
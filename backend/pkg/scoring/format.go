@@ -0,0 +1,53 @@
+// Package scoring keeps the score of a tennis match point by point. A
+// match is replayed from its list of point winners, so the points are the
+// only thing that needs storing.
+package scoring
+
+import "errors"
+
+// Format describes how a match is scored
+type Format struct {
+	Sets                int  `json:"sets"`                            // best of; odd
+	GamesPerSet         int  `json:"games_per_set"`                   // games needed to win a set, usually 6
+	NoAd                bool `json:"no_ad"`                           // a deciding point is played at deuce
+	TiebreakPoints      int  `json:"tiebreak_points"`                 // 0 plays advantage sets without tiebreaks
+	MatchTiebreak       bool `json:"match_tiebreak"`                  // the deciding set is a single tiebreak
+	MatchTiebreakPoints int  `json:"match_tiebreak_points,omitempty"` // usually 10
+}
+
+// DefaultFormat is best of three tiebreak sets with advantage scoring
+var DefaultFormat = Format{
+	Sets:           3,
+	GamesPerSet:    6,
+	TiebreakPoints: 7,
+}
+
+// Format validation errors
+var (
+	ErrInvalidSets          = errors.New("sets must be 1, 3 or 5")
+	ErrInvalidGamesPerSet   = errors.New("games per set must be between 1 and 9")
+	ErrInvalidTiebreak      = errors.New("tiebreak points must be between 0 and 15")
+	ErrInvalidMatchTiebreak = errors.New("match tiebreak points must be between 1 and 21")
+)
+
+// Validate checks the format can be played
+func (f Format) Validate() error {
+	if f.Sets != 1 && f.Sets != 3 && f.Sets != 5 {
+		return ErrInvalidSets
+	}
+	if f.GamesPerSet < 1 || f.GamesPerSet > 9 {
+		return ErrInvalidGamesPerSet
+	}
+	if f.TiebreakPoints < 0 || f.TiebreakPoints > 15 {
+		return ErrInvalidTiebreak
+	}
+	if f.MatchTiebreak && (f.MatchTiebreakPoints < 1 || f.MatchTiebreakPoints > 21) {
+		return ErrInvalidMatchTiebreak
+	}
+	return nil
+}
+
+// setsToWin is the number of sets that wins the match
+func (f Format) setsToWin() int {
+	return f.Sets/2 + 1
+}
@@ -0,0 +1,262 @@
+package scoring
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Side is one of the two sides of a match. The player is the user keeping
+// the score.
+type Side string
+
+// Sides of a match
+const (
+	SidePlayer   Side = "player"
+	SideOpponent Side = "opponent"
+)
+
+// ErrMatchOver is returned when a point is added to a finished match
+var ErrMatchOver = errors.New("match is already over")
+
+// ErrInvalidSide is returned for a side other than player or opponent
+var ErrInvalidSide = errors.New("side must be player or opponent")
+
+// IsValid checks if s is the player or the opponent
+func (s Side) IsValid() bool {
+	return s == SidePlayer || s == SideOpponent
+}
+
+// Other returns the opposing side
+func (s Side) Other() Side {
+	if s == SidePlayer {
+		return SideOpponent
+	}
+	return SidePlayer
+}
+
+// Pair holds a count for each side
+type Pair struct {
+	Player   int `json:"player"`
+	Opponent int `json:"opponent"`
+}
+
+// Of returns the count of one side
+func (p Pair) Of(s Side) int {
+	if s == SidePlayer {
+		return p.Player
+	}
+	return p.Opponent
+}
+
+func (p *Pair) inc(s Side) {
+	if s == SidePlayer {
+		p.Player++
+	} else {
+		p.Opponent++
+	}
+}
+
+func (p Pair) total() int {
+	return p.Player + p.Opponent
+}
+
+// SetScore is the score of one set
+type SetScore struct {
+	Games         Pair  `json:"games"`
+	Tiebreak      *Pair `json:"tiebreak,omitempty"` // points of the tiebreak, once played
+	MatchTiebreak bool  `json:"match_tiebreak,omitempty"`
+	Winner        Side  `json:"winner,omitempty"`
+}
+
+// State is the score of a match after some number of points
+type State struct {
+	Format   Format     `json:"format"`
+	Sets     []SetScore `json:"sets"`     // finished sets, then the set in progress
+	SetsWon  Pair       `json:"sets_won"` // finished sets won by each side
+	Game     Pair       `json:"game"`     // points of the current game or tiebreak
+	Tiebreak bool       `json:"tiebreak"` // the current game is a tiebreak
+	Server   Side       `json:"server"`   // serves the next point
+	Winner   Side       `json:"winner,omitempty"`
+	Points   int        `json:"points"` // points played
+
+	tiebreakServer Side // served the first point of the current tiebreak
+}
+
+// NewMatch starts a match in which first serves the first game
+func NewMatch(format Format, first Side) (*State, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	if !first.IsValid() {
+		return nil, ErrInvalidSide
+	}
+	s := &State{Format: format, Server: first}
+	s.startSet()
+	return s, nil
+}
+
+// Replay scores a match from the winners of its points in order
+func Replay(format Format, first Side, winners []Side) (*State, error) {
+	s, err := NewMatch(format, first)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range winners {
+		if err := s.AddPoint(w); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// IsOver checks if a side has won the match
+func (s *State) IsOver() bool {
+	return s.Winner != ""
+}
+
+// AddPoint records the winner of the next point
+func (s *State) AddPoint(winner Side) error {
+	if !winner.IsValid() {
+		return ErrInvalidSide
+	}
+	if s.IsOver() {
+		return ErrMatchOver
+	}
+
+	s.Points++
+	s.Game.inc(winner)
+	if s.Tiebreak {
+		s.tiebreakPoint(winner)
+	} else {
+		s.gamePoint(winner)
+	}
+	return nil
+}
+
+// gamePoint scores a point of a regular game
+func (s *State) gamePoint(winner Side) {
+	won, lost := s.Game.Of(winner), s.Game.Of(winner.Other())
+	if won < 4 || (!s.Format.NoAd && won-lost < 2) {
+		return
+	}
+
+	set := s.currentSet()
+	set.Games.inc(winner)
+	s.Game = Pair{}
+	s.Server = s.Server.Other()
+
+	games, other := set.Games.Of(winner), set.Games.Of(winner.Other())
+	n := s.Format.GamesPerSet
+	switch {
+	case games >= n && games-other >= 2:
+		s.endSet(winner)
+	case games == n && other == n && s.Format.TiebreakPoints > 0:
+		s.startTiebreak()
+	}
+}
+
+// tiebreakPoint scores a point of a tiebreak. Service changes after the
+// first point and then every two points.
+func (s *State) tiebreakPoint(winner Side) {
+	set := s.currentSet()
+	target := s.Format.TiebreakPoints
+	if set.MatchTiebreak {
+		target = s.Format.MatchTiebreakPoints
+	}
+
+	won, lost := s.Game.Of(winner), s.Game.Of(winner.Other())
+	if won < target || won-lost < 2 {
+		if (s.Game.total()+1)/2%2 == 0 {
+			s.Server = s.tiebreakServer
+		} else {
+			s.Server = s.tiebreakServer.Other()
+		}
+		return
+	}
+
+	points := s.Game
+	set.Tiebreak = &points
+	set.Games.inc(winner)
+	s.Game = Pair{}
+	s.Tiebreak = false
+	// The receiver of the first tiebreak point serves the next game
+	s.Server = s.tiebreakServer.Other()
+	s.endSet(winner)
+}
+
+func (s *State) startTiebreak() {
+	s.Tiebreak = true
+	s.tiebreakServer = s.Server
+}
+
+// startSet begins the next set, which is a match tiebreak if it is the
+// deciding set of a format that plays one
+func (s *State) startSet() {
+	deciding := len(s.Sets) == s.Format.Sets-1
+	s.Sets = append(s.Sets, SetScore{MatchTiebreak: deciding && s.Format.MatchTiebreak})
+	if s.currentSet().MatchTiebreak {
+		s.startTiebreak()
+	}
+}
+
+func (s *State) endSet(winner Side) {
+	s.currentSet().Winner = winner
+	s.SetsWon.inc(winner)
+	if s.SetsWon.Of(winner) >= s.Format.setsToWin() {
+		s.Winner = winner
+		return
+	}
+	s.startSet()
+}
+
+func (s *State) currentSet() *SetScore {
+	return &s.Sets[len(s.Sets)-1]
+}
+
+// GameScore describes the points of the current game from the player's
+// side, for example "30-15", "40-AD" or "5-3" in a tiebreak
+func (s *State) GameScore() string {
+	p, o := s.Game.Player, s.Game.Opponent
+	if s.Tiebreak {
+		return strconv.Itoa(p) + "-" + strconv.Itoa(o)
+	}
+	if p >= 3 && o >= 3 && !s.Format.NoAd {
+		switch {
+		case p > o:
+			return "AD-40"
+		case o > p:
+			return "40-AD"
+		}
+		return "40-40"
+	}
+	calls := []string{"0", "15", "30", "40"}
+	return calls[p] + "-" + calls[o]
+}
+
+// String is the canonical score from the player's side. Sets are listed in
+// order with the loser's tiebreak points in brackets and a match tiebreak
+// in square brackets, for example "6-4 6-7(5) [10-8]". While the match is
+// in progress the current game follows the set scores.
+func (s *State) String() string {
+	var parts []string
+	for _, set := range s.Sets {
+		switch {
+		case set.MatchTiebreak:
+			points := s.Game
+			if set.Tiebreak != nil {
+				points = *set.Tiebreak
+			}
+			parts = append(parts, "["+strconv.Itoa(points.Player)+"-"+strconv.Itoa(points.Opponent)+"]")
+		case set.Tiebreak != nil:
+			loser := set.Tiebreak.Of(set.Winner.Other())
+			parts = append(parts, strconv.Itoa(set.Games.Player)+"-"+strconv.Itoa(set.Games.Opponent)+"("+strconv.Itoa(loser)+")")
+		default:
+			parts = append(parts, strconv.Itoa(set.Games.Player)+"-"+strconv.Itoa(set.Games.Opponent))
+		}
+	}
+	if !s.IsOver() && !s.currentSet().MatchTiebreak && s.Game.total() > 0 {
+		parts = append(parts, s.GameScore())
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,271 @@
+package scoring
+
+import (
+	"strings"
+	"testing"
+)
+
+// points parses a sequence of point winners, p for the player and o for the
+// opponent. Spaces are ignored so games can be grouped.
+func points(seq string) []Side {
+	var winners []Side
+	for _, r := range seq {
+		switch r {
+		case 'p':
+			winners = append(winners, SidePlayer)
+		case 'o':
+			winners = append(winners, SideOpponent)
+		}
+	}
+	return winners
+}
+
+// holds returns n love games, won alternately by the player and the
+// opponent starting with the player
+func holds(n int) string {
+	var games []string
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			games = append(games, "pppp")
+		} else {
+			games = append(games, "oooo")
+		}
+	}
+	return strings.Join(games, " ")
+}
+
+// replay scores the sequence or fails the test
+func replay(t *testing.T, format Format, first Side, seq string) *State {
+	t.Helper()
+
+	s, err := Replay(format, first, points(seq))
+	if err != nil {
+		t.Fatalf("replay %q: %v", seq, err)
+	}
+	return s
+}
+
+var (
+	noAd          = Format{Sets: 3, GamesPerSet: 6, NoAd: true, TiebreakPoints: 7}
+	advantageSets = Format{Sets: 1, GamesPerSet: 6}
+	matchTiebreak = Format{Sets: 3, GamesPerSet: 6, TiebreakPoints: 7, MatchTiebreak: true, MatchTiebreakPoints: 10}
+)
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		first    Side
+		points   string
+		want     string
+		server   Side
+		tiebreak bool
+		winner   Side
+	}{
+		{
+			name:   "first point",
+			format: DefaultFormat, first: SidePlayer,
+			points: "p",
+			want:   "0-0 15-0", server: SidePlayer,
+		},
+		{
+			name:   "love set",
+			format: DefaultFormat, first: SidePlayer,
+			points: strings.Repeat("pppp ", 6),
+			want:   "6-0 0-0", server: SidePlayer,
+		},
+		{
+			name:   "deuce",
+			format: DefaultFormat, first: SidePlayer,
+			points: "pppooo",
+			want:   "0-0 40-40", server: SidePlayer,
+		},
+		{
+			name:   "advantage receiver",
+			format: DefaultFormat, first: SidePlayer,
+			points: "pppooo o",
+			want:   "0-0 40-AD", server: SidePlayer,
+		},
+		{
+			name:   "back to deuce",
+			format: DefaultFormat, first: SidePlayer,
+			points: "pppooo op",
+			want:   "0-0 40-40", server: SidePlayer,
+		},
+		{
+			name:   "no-ad deciding point won by the receiver",
+			format: noAd, first: SidePlayer,
+			points: "pppooo o",
+			want:   "0-1", server: SideOpponent,
+		},
+		{
+			name:   "no-ad deciding point won by the server",
+			format: noAd, first: SidePlayer,
+			points: "pppooo p",
+			want:   "1-0", server: SideOpponent,
+		},
+		{
+			name:   "tiebreak at six all",
+			format: DefaultFormat, first: SidePlayer,
+			points: holds(12),
+			want:   "6-6", server: SidePlayer, tiebreak: true,
+		},
+		{
+			name:   "tiebreak points",
+			format: DefaultFormat, first: SidePlayer,
+			points: holds(12) + " ppo",
+			want:   "6-6 2-1", server: SidePlayer, tiebreak: true,
+		},
+		{
+			name:   "tiebreak to love",
+			format: DefaultFormat, first: SidePlayer,
+			points: holds(12) + " ppppppp",
+			want:   "7-6(0) 0-0", server: SideOpponent,
+		},
+		{
+			name:   "tiebreak lost 5-7",
+			format: DefaultFormat, first: SidePlayer,
+			points: holds(12) + " ppppp ooooooo",
+			want:   "6-7(5) 0-0", server: SideOpponent,
+		},
+		{
+			name:   "extended tiebreak",
+			format: DefaultFormat, first: SidePlayer,
+			points: holds(12) + " pppppp oooooo popo pp",
+			want:   "7-6(8) 0-0", server: SideOpponent,
+		},
+		{
+			name:   "receiver of the first tiebreak point serves next",
+			format: DefaultFormat, first: SideOpponent,
+			points: holds(12) + " ppppppp",
+			want:   "7-6(0) 0-0", server: SidePlayer,
+		},
+		{
+			name:   "straight sets",
+			format: DefaultFormat, first: SidePlayer,
+			points: strings.Repeat("pppp ", 12),
+			want:   "6-0 6-0", winner: SidePlayer,
+		},
+		{
+			name:   "advantage set has no tiebreak",
+			format: advantageSets, first: SidePlayer,
+			points: holds(14),
+			want:   "7-7", server: SidePlayer,
+		},
+		{
+			name:   "advantage set won by two games",
+			format: advantageSets, first: SidePlayer,
+			points: holds(14) + " pppp pppp",
+			want:   "9-7", winner: SidePlayer,
+		},
+		{
+			name:   "match tiebreak starts the deciding set",
+			format: matchTiebreak, first: SidePlayer,
+			points: strings.Repeat("pppp ", 6) + strings.Repeat("oooo ", 6),
+			want:   "6-0 0-6 [0-0]", server: SidePlayer, tiebreak: true,
+		},
+		{
+			name:   "match tiebreak in progress",
+			format: matchTiebreak, first: SidePlayer,
+			points: strings.Repeat("pppp ", 6) + strings.Repeat("oooo ", 6) + "ppo",
+			want:   "6-0 0-6 [2-1]", server: SidePlayer, tiebreak: true,
+		},
+		{
+			name:   "match tiebreak won by two points",
+			format: matchTiebreak, first: SidePlayer,
+			points: strings.Repeat("pppp ", 6) + strings.Repeat("oooo ", 6) + strings.Repeat("po", 9) + "pp",
+			want:   "6-0 0-6 [11-9]", winner: SidePlayer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := replay(t, tt.format, tt.first, tt.points)
+			if got := s.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if s.Winner != tt.winner {
+				t.Errorf("winner = %q, want %q", s.Winner, tt.winner)
+			}
+			if tt.winner == "" && s.Server != tt.server {
+				t.Errorf("server = %q, want %q", s.Server, tt.server)
+			}
+			if s.Tiebreak != tt.tiebreak {
+				t.Errorf("tiebreak = %v, want %v", s.Tiebreak, tt.tiebreak)
+			}
+			if s.Points != len(points(tt.points)) {
+				t.Errorf("points = %d, want %d", s.Points, len(points(tt.points)))
+			}
+		})
+	}
+}
+
+func TestTiebreakServiceRotation(t *testing.T) {
+	tests := []struct {
+		name  string
+		first Side
+		want  string // server of each tiebreak point
+	}{
+		{name: "player serves first", first: SidePlayer, want: "poopp oopp oop"},
+		{name: "opponent serves first", first: SideOpponent, want: "oppoo ppoo ppo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Alternate the points so the tiebreak keeps going
+			s := replay(t, DefaultFormat, tt.first, holds(12))
+			for i, want := range points(tt.want) {
+				next, ok := s.Next()
+				if !ok || next.Server != want {
+					t.Fatalf("point %d served by %q, want %q", i+1, next.Server, want)
+				}
+				winner := SidePlayer
+				if i%2 == 1 {
+					winner = SideOpponent
+				}
+				if err := s.AddPoint(winner); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAddPointErrors(t *testing.T) {
+	s := replay(t, DefaultFormat, SidePlayer, "")
+	if err := s.AddPoint("umpire"); err != ErrInvalidSide {
+		t.Errorf("invalid side: err = %v, want %v", err, ErrInvalidSide)
+	}
+
+	s = replay(t, DefaultFormat, SidePlayer, strings.Repeat("pppp ", 12))
+	if err := s.AddPoint(SidePlayer); err != ErrMatchOver {
+		t.Errorf("finished match: err = %v, want %v", err, ErrMatchOver)
+	}
+	if _, ok := s.Next(); ok {
+		t.Error("Next reported a point after the match")
+	}
+}
+
+func TestFormatValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		want   error
+	}{
+		{name: "default", format: DefaultFormat},
+		{name: "advantage sets", format: advantageSets},
+		{name: "match tiebreak", format: matchTiebreak},
+		{name: "even sets", format: Format{Sets: 2, GamesPerSet: 6}, want: ErrInvalidSets},
+		{name: "no games", format: Format{Sets: 3}, want: ErrInvalidGamesPerSet},
+		{name: "long tiebreak", format: Format{Sets: 3, GamesPerSet: 6, TiebreakPoints: 16}, want: ErrInvalidTiebreak},
+		{name: "match tiebreak without points", format: Format{Sets: 3, GamesPerSet: 6, MatchTiebreak: true}, want: ErrInvalidMatchTiebreak},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Validate(); err != tt.want {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
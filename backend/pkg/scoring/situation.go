@@ -0,0 +1,49 @@
+package scoring
+
+// Situation describes the point about to be played
+type Situation struct {
+	Set        int  `json:"set"`   // 1 for the first set
+	Game       int  `json:"game"`  // game of the set, 1 for the first; a tiebreak follows the last game
+	Point      int  `json:"point"` // point of the game or tiebreak, 1 for the first
+	Server     Side `json:"server"`
+	BreakPoint bool `json:"break_point"` // the receiver wins the game with the point
+	SetPoint   bool `json:"set_point"`   // either side wins the set with the point
+}
+
+// Next describes the next point. It reports false once the match is over.
+func (s *State) Next() (Situation, bool) {
+	if s.IsOver() {
+		return Situation{}, false
+	}
+
+	set := s.currentSet()
+	next := Situation{
+		Set:    len(s.Sets),
+		Game:   set.Games.total() + 1,
+		Point:  s.Game.total() + 1,
+		Server: s.Server,
+	}
+	receiver := s.Server.Other()
+	next.BreakPoint = !s.Tiebreak && s.winsGame(receiver)
+	next.SetPoint = s.winsSet(SidePlayer) || s.winsSet(SideOpponent)
+	return next, true
+}
+
+// winsGame checks if side wins the current game with the next point
+func (s *State) winsGame(side Side) bool {
+	return s.afterPoint(side).Game.total() == 0
+}
+
+// winsSet checks if side wins the current set with the next point
+func (s *State) winsSet(side Side) bool {
+	return s.afterPoint(side).SetsWon.Of(side) > s.SetsWon.Of(side)
+}
+
+// afterPoint returns a copy of the state with the next point won by side.
+// The match must not be over.
+func (s *State) afterPoint(side Side) *State {
+	after := *s
+	after.Sets = append([]SetScore(nil), s.Sets...)
+	after.AddPoint(side)
+	return &after
+}
@@ -0,0 +1,106 @@
+package scoring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		first  Side
+		points string
+		want   Situation
+	}{
+		{
+			name:   "first point",
+			format: DefaultFormat, first: SidePlayer,
+			want: Situation{Set: 1, Game: 1, Point: 1, Server: SidePlayer},
+		},
+		{
+			name:   "break point at 30-40",
+			format: DefaultFormat, first: SidePlayer,
+			points: "popoo",
+			want:   Situation{Set: 1, Game: 1, Point: 6, Server: SidePlayer, BreakPoint: true},
+		},
+		{
+			name:   "game point for the server at 40-30",
+			format: DefaultFormat, first: SidePlayer,
+			points: "popop",
+			want:   Situation{Set: 1, Game: 1, Point: 6, Server: SidePlayer},
+		},
+		{
+			name:   "no break point at deuce",
+			format: DefaultFormat, first: SidePlayer,
+			points: "pppooo",
+			want:   Situation{Set: 1, Game: 1, Point: 7, Server: SidePlayer},
+		},
+		{
+			name:   "no-ad deciding point is a break point",
+			format: noAd, first: SidePlayer,
+			points: "pppooo",
+			want:   Situation{Set: 1, Game: 1, Point: 7, Server: SidePlayer, BreakPoint: true},
+		},
+		{
+			name:   "player's break point on the opponent's serve",
+			format: DefaultFormat, first: SidePlayer,
+			points: "pppp ppp",
+			want:   Situation{Set: 1, Game: 2, Point: 4, Server: SideOpponent, BreakPoint: true},
+		},
+		{
+			name:   "break point and set point",
+			format: DefaultFormat, first: SidePlayer,
+			points: strings.Repeat("pppp ", 5) + "ppp",
+			want:   Situation{Set: 1, Game: 6, Point: 4, Server: SideOpponent, BreakPoint: true, SetPoint: true},
+		},
+		{
+			name:   "set point on serve",
+			format: DefaultFormat, first: SideOpponent,
+			points: holds(9) + " ppp",
+			want:   Situation{Set: 1, Game: 10, Point: 4, Server: SidePlayer, SetPoint: true},
+		},
+		{
+			name:   "set point in a tiebreak",
+			format: DefaultFormat, first: SidePlayer,
+			points: holds(12) + " pppppp ooooo",
+			want:   Situation{Set: 1, Game: 13, Point: 12, Server: SidePlayer, SetPoint: true},
+		},
+		{
+			name:   "no set point at six all in an advantage set",
+			format: advantageSets, first: SidePlayer,
+			points: holds(12) + " ppp",
+			want:   Situation{Set: 1, Game: 13, Point: 4, Server: SidePlayer},
+		},
+		{
+			name:   "set point at 6-5 in an advantage set",
+			format: advantageSets, first: SidePlayer,
+			points: holds(12) + " pppp ppp",
+			want:   Situation{Set: 1, Game: 14, Point: 4, Server: SideOpponent, BreakPoint: true, SetPoint: true},
+		},
+		{
+			name:   "match point in a match tiebreak",
+			format: matchTiebreak, first: SidePlayer,
+			points: strings.Repeat("pppp ", 6) + strings.Repeat("oooo ", 6) + strings.Repeat("po", 8) + "p",
+			want:   Situation{Set: 3, Game: 1, Point: 18, Server: SideOpponent, SetPoint: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := replay(t, tt.format, tt.first, tt.points)
+			before := s.String()
+
+			got, ok := s.Next()
+			if !ok {
+				t.Fatal("Next reported the match over")
+			}
+			if got != tt.want {
+				t.Errorf("Next() = %+v, want %+v", got, tt.want)
+			}
+			if s.String() != before || s.Points != len(points(tt.points)) {
+				t.Errorf("Next changed the score to %q", s.String())
+			}
+		})
+	}
+}